@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// canReadCategory reports whether the caller may see category and its images.
+// Category managers can read every category.
+func canReadCategory(c *gin.Context, category models.Category) bool {
+	return hasPermission(c, models.PermCategoryManage) || readableBy(category, principal(c))
+}
+
+// readableBy reports whether caller, without category:manage, may read
+// category. Anonymous callers have no user ID.
+func readableBy(category models.Category, caller models.Principal) bool {
+	switch category.Visibility {
+	case models.CategoryPublic:
+		return true
+	case models.CategoryRestricted:
+		return caller.UserID != "" && (slices.Contains(category.AllowedUsers, caller.UserID) ||
+			slices.Contains(category.AllowedRoles, caller.Role) ||
+			slices.Contains(category.Contributors, caller.UserID))
+	default:
+		return caller.UserID != ""
+	}
+}
+
+// canUploadTo reports whether the caller may upload to category: with
+// image:upload to any category they can read, or as one of its contributors.
+func canUploadTo(c *gin.Context, category models.Category) bool {
+	if slices.Contains(category.Contributors, principal(c).UserID) {
+		return true
+	}
+	return hasPermission(c, models.PermImageUpload) && canReadCategory(c, category)
+}
+
+// readableCategories returns a condition on a category slug that matches the
+// categories the caller can read, or nil when they can read all of them.
+// Anonymous callers only get public categories, so images of categories that
+// no longer exist stay hidden from them.
+func readableCategories(ctx context.Context, c *gin.Context) (bson.M, error) {
+	if hasPermission(c, models.PermCategoryManage) {
+		return nil, nil
+	}
+	collection := database.Client.Database("imagestore").Collection("categories")
+
+	if principal(c).UserID == "" {
+		slugs := []string{}
+		err := collection.Distinct(ctx, "slug", bson.M{"visibility": models.CategoryPublic}).Decode(&slugs)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"$in": slugs}, nil
+	}
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"visibility": bson.M{"$ne": models.CategoryPublic}},
+		options.Find().SetProjection(bson.M{"slug": 1, "visibility": 1, "allowed_users": 1, "allowed_roles": 1, "contributors": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	denied := []string{}
+	for _, category := range categories {
+		if !canReadCategory(c, category) {
+			denied = append(denied, category.Slug)
+		}
+	}
+	if len(denied) == 0 {
+		return nil, nil
+	}
+	return bson.M{"$nin": denied}, nil
+}
+
+// readableOnly restricts filter to images in categories the caller can read,
+// writing a 500 when the categories can't be loaded.
+func readableOnly(ctx context.Context, c *gin.Context, filter bson.M) bool {
+	condition, err := readableCategories(ctx, c)
+	if err != nil {
+		log.Println("Error getting category access:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return false
+	}
+	inCategories(filter, "category", condition)
+	return true
+}
+
+// inCategories adds condition, as returned by readableCategories, on the
+// category field of filter. It goes under $and so a category the caller
+// filters by is kept.
+func inCategories(filter bson.M, field string, condition bson.M) bson.M {
+	if condition != nil {
+		and, _ := filter["$and"].(bson.A)
+		filter["$and"] = append(and, bson.M{field: condition})
+	}
+	return filter
+}
@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"ginmongo/models"
+	"testing"
+)
+
+func TestReadableBy(t *testing.T) {
+	member := models.Principal{UserID: "u1", Role: models.RoleUser}
+	restricted := models.Category{
+		Visibility:   models.CategoryRestricted,
+		AllowedUsers: []string{"u1"},
+		AllowedRoles: []string{"editor"},
+		Contributors: []string{"u3"},
+	}
+	tests := []struct {
+		name     string
+		category models.Category
+		caller   models.Principal
+		want     bool
+	}{
+		{"public, anonymous", models.Category{Visibility: models.CategoryPublic}, models.Principal{}, true},
+		{"members, anonymous", models.Category{}, models.Principal{}, false},
+		{"members, signed in", models.Category{}, member, true},
+		{"restricted, allowed user", restricted, member, true},
+		{"restricted, allowed role", restricted, models.Principal{UserID: "u2", Role: "editor"}, true},
+		{"restricted, contributor", restricted, models.Principal{UserID: "u3", Role: models.RoleUser}, true},
+		{"restricted, other user", restricted, models.Principal{UserID: "u4", Role: models.RoleUser}, false},
+	}
+	for _, tt := range tests {
+		if got := readableBy(tt.category, tt.caller); got != tt.want {
+			t.Errorf("%s: readableBy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/middlewares"
+	"ginmongo/models"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// userProjection leaves the password and reset token out of admin responses.
+var userProjection = bson.M{"password": 0, "password_reset_token": 0, "password_token_expired": 0}
+
+// userUpdate is the body of UpdateUser. Fields left out are unchanged.
+type userUpdate struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// GetUsers lists users, newest first. Filters: q (part of the email or name),
+// role and disabled.
+func GetUsers(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := bson.M{"$regex": regexp.QuoteMeta(q), "$options": "i"}
+		filter["$or"] = bson.A{
+			bson.M{"email": pattern},
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+		}
+	}
+	if role := c.Query("role"); role != "" {
+		filter["role"] = role
+	}
+	if raw := c.Query("disabled"); raw != "" {
+		disabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "disabled must be true or false"})
+			return
+		}
+		if disabled {
+			filter["disabled"] = true
+		} else {
+			filter["disabled"] = bson.M{"$ne": true}
+		}
+	}
+
+	collection := database.Client.Database("imagestore").Collection("users")
+	page, limit, skip := paginationParams(c)
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).SetProjection(userProjection)
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting users"})
+		return
+	}
+	users := []models.User{}
+	if err = cursor.All(ctx, &users); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users":      users,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
+
+// outranks reports whether a role with permissions grants one the caller
+// lacks. Callers with role:manage could give themselves any permission, so
+// nothing outranks them.
+func outranks(c *gin.Context, permissions []string) bool {
+	if hasPermission(c, models.PermRoleManage) {
+		return false
+	}
+	for _, permission := range permissions {
+		if !hasPermission(c, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// manageableUser reports whether the caller may change the account of
+// userID, which they can't when its role outranks theirs. It writes the error
+// response when not.
+func manageableUser(ctx context.Context, c *gin.Context, userID string) bool {
+	db := database.Client.Database("imagestore")
+	var user models.User
+	err := db.Collection("users").FindOne(ctx, bson.M{"user_id": userID},
+		options.FindOne().SetProjection(bson.M{"role": 1})).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return false
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return false
+	}
+
+	// A role that no longer exists grants nothing.
+	var role models.Role
+	err = db.Collection("roles").FindOne(ctx, bson.M{"_id": user.Role}).Decode(&role)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting role"})
+		return false
+	}
+	if outranks(c, role.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This user's role has permissions you don't have"})
+		return false
+	}
+	return true
+}
+
+// UpdateUser changes a user's role or disables their account. Either change
+// logs the user out everywhere, so their tokens can't keep the old role.
+func UpdateUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.Param("id")
+	var body userUpdate
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	if body.Role == nil && body.Disabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role or disabled is required"})
+		return
+	}
+	// Keeps admins from locking themselves out.
+	if userID == principal(c).UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't change your own role or disable yourself"})
+		return
+	}
+
+	if !manageableUser(ctx, c, userID) {
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if body.Role != nil {
+		var role models.Role
+		err := db.Collection("roles").FindOne(ctx, bson.M{"_id": *body.Role}).Decode(&role)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting role"})
+			return
+		}
+		if outranks(c, role.Permissions) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't assign a role with permissions you don't have"})
+			return
+		}
+		set["role"] = *body.Role
+	}
+	if body.Disabled != nil {
+		if *body.Disabled {
+			set["disabled"] = true
+		} else {
+			update["$unset"] = bson.M{"disabled": ""}
+		}
+	}
+
+	var user models.User
+	err := db.Collection("users").FindOneAndUpdate(ctx, bson.M{"user_id": userID}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(userProjection)).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	middlewares.InvalidateDisabledUsers()
+
+	if _, err := revokeSessions(ctx, bson.M{"user_id": userID}); err != nil {
+		log.Println("Error revoking sessions of", userID, ":", err)
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser removes an account and logs it out everywhere. Images, comments
+// and reactions of the user are kept.
+func DeleteUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.Param("id")
+	if userID == principal(c).UserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't delete yourself"})
+		return
+	}
+	if !manageableUser(ctx, c, userID) {
+		return
+	}
+
+	result, err := database.Client.Database("imagestore").Collection("users").DeleteOne(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if _, err := revokeSessions(ctx, bson.M{"user_id": userID}); err != nil {
+		log.Println("Error revoking sessions of", userID, ":", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
+
+// ForcePasswordReset logs a user out everywhere and emails them a reset
+// link. They can't log in again until they have used it.
+func ForcePasswordReset(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID := c.Param("id")
+	if !manageableUser(ctx, c, userID) {
+		return
+	}
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"password_reset_required": true, "updated_at": time.Now()}}).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	revoked, err := revokeSessions(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Println("Error revoking sessions of", userID, ":", err)
+	}
+
+	if err = sendPasswordReset(ctx, user, true); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset required but the email could not be sent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "revoked": revoked})
+}
@@ -0,0 +1,472 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxAlbumImages caps the size of an album, whose entries live in one document.
+const maxAlbumImages = 1000
+
+type albumImages struct {
+	ImageIDs []string `json:"image_ids"`
+}
+
+// loadAlbum reads the album named by the :id parameter. Owners can always
+// see and change their albums; other users can only see unlisted and public
+// ones. On failure the response has been written and nil is returned.
+func loadAlbum(ctx context.Context, c *gin.Context, forWrite bool) *models.Album {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil
+	}
+	albumID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid album id"})
+		return nil
+	}
+
+	album := &models.Album{}
+	err = database.Client.Database("imagestore").Collection("albums").FindOne(ctx, bson.M{"_id": albumID}).Decode(album)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting album"})
+		return nil
+	}
+
+	if album.OwnerID == userID {
+		return album
+	}
+	// Don't reveal private albums to anyone but their owner.
+	if album.Visibility == models.AlbumPrivate {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Album not found"})
+		return nil
+	}
+	if forWrite {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner can change this album"})
+		return nil
+	}
+	return album
+}
+
+// parseImageIDs turns hex ids into ObjectIDs, dropping duplicates.
+func parseImageIDs(raw []string) ([]bson.ObjectID, bool) {
+	seen := make(map[bson.ObjectID]bool, len(raw))
+	ids := make([]bson.ObjectID, 0, len(raw))
+	for _, hex := range raw {
+		id, err := bson.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+func CreateAlbum(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var album models.Album
+	if err := c.ShouldBind(&album); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	album.Name = strings.TrimSpace(album.Name)
+	if album.Visibility == "" {
+		album.Visibility = models.AlbumPrivate
+	}
+	if err := validator.New().Struct(album); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+
+	album.ID = bson.NilObjectID
+	album.OwnerID = userID
+	album.ImageIDs = []bson.ObjectID{}
+	album.CreatedAt = time.Now()
+	album.UpdatedAt = album.CreatedAt
+
+	result, err := database.Client.Database("imagestore").Collection("albums").InsertOne(ctx, album)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating album"})
+		return
+	}
+	album.ID = result.InsertedID.(bson.ObjectID)
+
+	c.JSON(http.StatusOK, album)
+}
+
+// GetAlbums lists the caller's albums, or everyone's public albums with
+// public=true, most recently changed first.
+func GetAlbums(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"owner_id": userID}
+	if public, _ := strconv.ParseBool(c.Query("public")); public {
+		filter = bson.M{"visibility": models.AlbumPublic}
+	}
+	page, limit, skip := paginationParams(c)
+
+	collection := database.Client.Database("imagestore").Collection("albums")
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting albums"})
+		return
+	}
+	albums := []models.Album{}
+	if err = cursor.All(ctx, &albums); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting albums"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"albums":     albums,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
+
+// GetAlbum returns an album with one page of its images, in album order.
+func GetAlbum(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, false)
+	if album == nil {
+		return
+	}
+	page, limit, skip := paginationParams(c)
+
+	// Images the caller can't see, or no longer can, are left out of the
+	// album entirely: its count, its pages and its image_ids.
+	images := database.Client.Database("imagestore").Collection("images")
+	// Appending makes an empty album an empty $in rather than a null one.
+	filter := publishedOnly(bson.M{"_id": bson.M{"$in": append([]bson.ObjectID{}, album.ImageIDs...)}})
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+	var visible []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	cursor, err := images.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err == nil {
+		err = cursor.All(ctx, &visible)
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+	isVisible := make(map[bson.ObjectID]bool, len(visible))
+	for _, img := range visible {
+		isVisible[img.ID] = true
+	}
+	visibleIDs := make([]bson.ObjectID, 0, len(visible))
+	for _, id := range album.ImageIDs {
+		if isVisible[id] {
+			visibleIDs = append(visibleIDs, id)
+		}
+	}
+	album.ImageIDs = visibleIDs
+
+	total := int64(len(visibleIDs))
+	pageIDs := visibleIDs[min(skip, len(visibleIDs)):min(skip+limit, len(visibleIDs))]
+
+	var pageImages []models.Image
+	if len(pageIDs) > 0 {
+		filter["_id"] = bson.M{"$in": pageIDs}
+		cursor, err := images.Find(ctx, filter)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+			return
+		}
+		var found []models.Image
+		if err = cursor.All(ctx, &found); err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing images"})
+			return
+		}
+
+		byID := make(map[bson.ObjectID]models.Image, len(found))
+		for _, img := range found {
+			byID[img.ID] = img
+		}
+		for _, id := range pageIDs {
+			if img, ok := byID[id]; ok {
+				pageImages = append(pageImages, img)
+			}
+		}
+	}
+
+	responseImages := presignImages(ctx, os.Getenv("BUCKET_NAME"), pageImages, 10*time.Minute)
+	markReactions(c, responseImages)
+	hideLocations(c, responseImages)
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":      album,
+		"images":     responseImages,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
+
+// UpdateAlbum renames an album and/or changes its visibility.
+func UpdateAlbum(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, true)
+	if album == nil {
+		return
+	}
+
+	var update struct {
+		Name       *string `json:"name"`
+		Visibility *string `json:"visibility"`
+	}
+	if err := c.ShouldBind(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	if update.Name != nil {
+		album.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Visibility != nil {
+		album.Visibility = *update.Visibility
+	}
+	if err := validator.New().Struct(album); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+	album.UpdatedAt = time.Now()
+
+	_, err := database.Client.Database("imagestore").Collection("albums").UpdateByID(ctx, album.ID, bson.M{"$set": bson.M{
+		"name":       album.Name,
+		"visibility": album.Visibility,
+		"updated_at": album.UpdatedAt,
+	}})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating album"})
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+func DeleteAlbum(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, true)
+	if album == nil {
+		return
+	}
+
+	if _, err := database.Client.Database("imagestore").Collection("albums").DeleteOne(ctx, bson.M{"_id": album.ID}); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting album"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
+
+// AddAlbumImages appends images to the end of an album. Images already in
+// the album keep their place.
+func AddAlbumImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, true)
+	if album == nil {
+		return
+	}
+
+	var body albumImages
+	if err := c.ShouldBind(&body); err != nil || len(body.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids is required"})
+		return
+	}
+	ids, ok := parseImageIDs(body.ImageIDs)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+	if len(ids) > maxAlbumImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Albums can hold at most 1000 images"})
+		return
+	}
+
+	// Only images the caller can see can be added, the same ones GetAlbum
+	// shows, so adding can't tell whether the others exist.
+	filter := publishedOnly(bson.M{"_id": bson.M{"$in": ids}})
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+	found, err := database.Client.Database("imagestore").Collection("images").CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if found != int64(len(ids)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Some images were not found"})
+		return
+	}
+
+	// The size check is part of the update, so concurrent adds can't take
+	// the album over the limit.
+	err = database.Client.Database("imagestore").Collection("albums").FindOneAndUpdate(ctx,
+		bson.M{
+			"_id": album.ID,
+			"$expr": bson.M{"$lte": bson.A{
+				bson.M{"$size": bson.M{"$ifNull": bson.A{"$image_ids", bson.A{}}}},
+				maxAlbumImages - len(ids),
+			}},
+		},
+		bson.M{
+			"$addToSet": bson.M{"image_ids": bson.M{"$each": ids}},
+			"$set":      bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(album)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Albums can hold at most 1000 images"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating album"})
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+func RemoveAlbumImage(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, true)
+	if album == nil {
+		return
+	}
+	imageID, err := bson.ObjectIDFromHex(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+
+	err = database.Client.Database("imagestore").Collection("albums").FindOneAndUpdate(ctx,
+		bson.M{"_id": album.ID},
+		bson.M{
+			"$pull": bson.M{"image_ids": imageID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(album)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating album"})
+		return
+	}
+	c.JSON(http.StatusOK, album)
+}
+
+// ReorderAlbumImages replaces the album order. The posted ids must be exactly
+// the images in the album; if the album changed in the meantime the request
+// is rejected with a 409 so the client can reload it.
+func ReorderAlbumImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	album := loadAlbum(ctx, c, true)
+	if album == nil {
+		return
+	}
+
+	var body albumImages
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	ids, ok := parseImageIDs(body.ImageIDs)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+
+	current := make(map[bson.ObjectID]bool, len(album.ImageIDs))
+	for _, id := range album.ImageIDs {
+		current[id] = true
+	}
+	sameImages := len(ids) == len(album.ImageIDs)
+	for _, id := range ids {
+		sameImages = sameImages && current[id]
+	}
+	if !sameImages {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "image_ids must list every image in the album exactly once"})
+		return
+	}
+
+	result, err := database.Client.Database("imagestore").Collection("albums").UpdateOne(ctx,
+		bson.M{"_id": album.ID, "image_ids": album.ImageIDs},
+		bson.M{"$set": bson.M{"image_ids": ids, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating album"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Album changed, reload and try again"})
+		return
+	}
+	album.ImageIDs = ids
+	c.JSON(http.StatusOK, album)
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// recordFailure counts a credential check for key and returns the count so
+// far. Checks are counted before they are made and the count cleared when
+// one succeeds, so what is left are failures, and the count a check gets is
+// atomic even when they run in parallel. The count starts over window after
+// the first one.
+func recordFailure(ctx context.Context, key string, window time.Duration) (models.AuthFailure, error) {
+	now := time.Now()
+	// Counts the TTL index hasn't removed yet start over too.
+	active := bson.M{"$gt": bson.A{"$expires_at", now}}
+	var failure models.AuthFailure
+	err := database.Client.Database("imagestore").Collection("auth_failures").FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"count":       bson.M{"$cond": bson.A{active, bson.M{"$add": bson.A{"$count", 1}}, 1}},
+			"last_at":     now,
+			"previous_at": bson.M{"$cond": bson.A{active, "$last_at", "$$REMOVE"}},
+			"expires_at":  bson.M{"$cond": bson.A{active, "$expires_at", now.Add(window)}},
+		}}}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&failure)
+	return failure, err
+}
+
+// clearFailures forgets the failures of key after a successful check.
+func clearFailures(ctx context.Context, key string) error {
+	_, err := database.Client.Database("imagestore").Collection("auth_failures").DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// forgiveFailure takes back one check counted for key, e.g. the successful
+// login of an IP address whose failures should still count.
+func forgiveFailure(ctx context.Context, key string) error {
+	_, err := database.Client.Database("imagestore").Collection("auth_failures").UpdateOne(ctx,
+		bson.M{"_id": key, "count": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"count": -1}})
+	return err
+}
+
+// extendFailures keeps the failures of key counted until until, e.g. for the
+// length of a lockout.
+func extendFailures(ctx context.Context, key string, until time.Time) error {
+	_, err := database.Client.Database("imagestore").Collection("auth_failures").UpdateOne(ctx,
+		bson.M{"_id": key}, bson.M{"$max": bson.M{"expires_at": until}})
+	return err
+}
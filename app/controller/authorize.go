@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"ginmongo/middlewares"
+	"ginmongo/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principal returns the caller of the request, or the zero Principal on
+// routes without the JWT middleware.
+func principal(c *gin.Context) models.Principal {
+	p, _ := middlewares.CurrentPrincipal(c)
+	return p
+}
+
+// hasPermission reports whether the caller's role grants permission, without
+// writing a response. Routes requiring a permission outright use
+// middlewares.RequirePermission instead.
+func hasPermission(c *gin.Context, permission string) bool {
+	return middlewares.HasPermission(c, permission)
+}
+
+// currentUserID returns the user ID set by the JWT middleware, writing a 401
+// for tokens issued before they carried one.
+func currentUserID(c *gin.Context) (string, bool) {
+	userID := principal(c).UserID
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has no user, please log in again"})
+		return "", false
+	}
+	return userID, true
+}
@@ -0,0 +1,799 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	errUnknownCategory = errors.New("unknown category")
+	errUnknownParent   = errors.New("parent category not found")
+)
+
+// categoryPath builds the materialized path of a category with the given
+// slug placed under parent (a slug, or "" for the top level).
+func categoryPath(ctx context.Context, parent, slug string) (string, error) {
+	if parent == "" {
+		return slug, nil
+	}
+
+	var parentCategory models.Category
+	err := database.Client.Database("imagestore").Collection("categories").
+		FindOne(ctx, bson.M{"slug": parent}).Decode(&parentCategory)
+	if err == mongo.ErrNoDocuments {
+		return "", errUnknownParent
+	}
+	if err != nil {
+		return "", err
+	}
+	return parentCategory.Path + "/" + slug, nil
+}
+
+// descendantSlugs returns the slugs of every category below the one at path.
+func descendantSlugs(ctx context.Context, path string) ([]string, error) {
+	cursor, err := database.Client.Database("imagestore").Collection("categories").Find(ctx,
+		bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(path+"/")}},
+		options.Find().SetProjection(bson.M{"slug": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var categories []models.Category
+	if err = cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+
+	slugs := make([]string, 0, len(categories))
+	for _, category := range categories {
+		slugs = append(slugs, category.Slug)
+	}
+	return slugs, nil
+}
+
+// categoryMatch returns the images.category condition for the category
+// called name: its slug and, with recursive=true, the slugs of every
+// category below it too.
+func categoryMatch(ctx context.Context, c *gin.Context, name string) (any, error) {
+	slug := utils.Slugify(name)
+	if recursive, _ := strconv.ParseBool(c.Query("recursive")); !recursive {
+		return slug, nil
+	}
+
+	var parent models.Category
+	err := database.Client.Database("imagestore").Collection("categories").
+		FindOne(ctx, bson.M{"slug": slug}).Decode(&parent)
+	if err == mongo.ErrNoDocuments {
+		return slug, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slugs, err := descendantSlugs(ctx, parent.Path)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$in": append(slugs, slug)}, nil
+}
+
+// resolveCategory finds the category an upload names, matching on the
+// normalised slug so "Anime ", "anime" and "ANIME" are the same category.
+// With create set, a missing category is created from the given name.
+func resolveCategory(ctx context.Context, name string, create bool) (*models.Category, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	slug := utils.Slugify(name)
+	if slug == "" {
+		return nil, errUnknownCategory
+	}
+
+	collection := database.Client.Database("imagestore").Collection("categories")
+
+	category := &models.Category{}
+	err := collection.FindOne(ctx, bson.M{"slug": slug}).Decode(category)
+	if err == nil {
+		return category, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+	if !create {
+		return nil, errUnknownCategory
+	}
+
+	// Upsert so two uploads racing to create the same category both succeed.
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"slug": slug},
+		bson.M{"$setOnInsert": bson.M{"category": name, "slug": slug, "path": slug, "updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(category)
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+type categoryUpdate struct {
+	Category    string  `json:"category"`
+	Slug        string  `json:"slug"`
+	Description *string `json:"description"`
+	// Parent moves the category, with everything below it, under another
+	// category. An empty string moves it to the top level.
+	Parent *string `json:"parent"`
+}
+
+// categoryCard is a category as listed by GetCategories, with the numbers and
+// cover image the frontend shows on category cards.
+type categoryCard struct {
+	models.Category
+	ImageCount   int64          `json:"image_count"`
+	LastUploadAt *time.Time     `json:"last_upload_at,omitempty"`
+	Cover        *ImageResponse `json:"cover,omitempty"`
+}
+
+// categoryStats is what the images collection knows about one category.
+type categoryStats struct {
+	Slug          string        `bson:"_id"`
+	ImageCount    int64         `bson:"image_count"`
+	LastUploadAt  time.Time     `bson:"last_upload_at"`
+	LatestImageID bson.ObjectID `bson:"latest_image_id"`
+}
+
+// categoryNode is one category in the tree returned by GetCategoryTree.
+type categoryNode struct {
+	models.Category
+	Children []*categoryNode `json:"children"`
+}
+
+func CreateCategory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var category models.Category
+
+	if err := c.ShouldBind(&category); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "INvalid payload"})
+		return
+	}
+
+	category.Category = strings.Join(strings.Fields(category.Category), " ")
+	category.Slug = utils.Slugify(category.Slug)
+	if category.Slug == "" {
+		category.Slug = utils.Slugify(category.Category)
+	}
+	if category.Category == "" || category.Slug == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category name is required"})
+		return
+	}
+
+	if category.Visibility == "" {
+		category.Visibility = models.CategoryMembers
+	}
+	if !validVisibility(category.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, members or restricted"})
+		return
+	}
+
+	category.Parent = utils.Slugify(category.Parent)
+	path, err := categoryPath(ctx, category.Parent, category.Slug)
+	if err == errUnknownParent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating category"})
+		return
+	}
+
+	collection := database.Client.Database("imagestore").Collection("categories")
+
+	// New categories go to the end of the manual order.
+	sortOrder, err := collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	_, err = collection.InsertOne(ctx, bson.M{
+		"category":    category.Category,
+		"slug":        category.Slug,
+		"parent":      category.Parent,
+		"path":        path,
+		"description": strings.TrimSpace(category.Description),
+		"sort_order":  sortOrder,
+		"visibility":  category.Visibility,
+		"updated_at":  time.Now(),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category already exists"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating category"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":     true,
+		"category":   category.Category,
+		"slug":       category.Slug,
+		"parent":     category.Parent,
+		"path":       path,
+		"visibility": category.Visibility,
+	})
+}
+
+// GetCategories lists the categories the caller can read in their manual order with a live image
+// count, the time of the latest upload and a presigned cover image, which is
+// the chosen cover or else the newest image.
+func GetCategories(c *gin.Context) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var category []models.Category
+
+	db := database.Client.Database("imagestore")
+	collection := db.Collection("categories")
+
+	cursor, err := collection.Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}, {Key: "category", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return
+	}
+	if err = cursor.All(ctx, &category); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing images"})
+		return
+	}
+	category = slices.DeleteFunc(category, func(cat models.Category) bool { return !canReadCategory(c, cat) })
+
+	statsCursor, err := db.Collection("images").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: publishedOnly(bson.M{})}},
+		{{Key: "$sort", Value: bson.D{{Key: "uploaded_at", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":             "$category",
+			"image_count":     bson.M{"$sum": 1},
+			"last_upload_at":  bson.M{"$first": "$uploaded_at"},
+			"latest_image_id": bson.M{"$first": "$_id"},
+		}}},
+	})
+	if err != nil {
+		log.Println("Mongo aggregate error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting images"})
+		return
+	}
+	var stats []categoryStats
+	if err = statsCursor.All(ctx, &stats); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting images"})
+		return
+	}
+	statsBySlug := make(map[string]categoryStats, len(stats))
+	for _, stat := range stats {
+		statsBySlug[stat.Slug] = stat
+	}
+
+	cards := make([]categoryCard, 0, len(category))
+	coverIDs := bson.A{}
+	for _, cat := range category {
+		card := categoryCard{Category: cat}
+		if stat, ok := statsBySlug[cat.Slug]; ok {
+			card.ImageCount = stat.ImageCount
+			card.LastUploadAt = &stat.LastUploadAt
+			if card.CoverImageID == nil {
+				card.CoverImageID = &stat.LatestImageID
+			}
+		}
+		if card.CoverImageID != nil {
+			coverIDs = append(coverIDs, *card.CoverImageID)
+		}
+		cards = append(cards, card)
+	}
+
+	if len(coverIDs) > 0 {
+		var covers []models.Image
+		coverCursor, err := db.Collection("images").Find(ctx, publishedOnly(bson.M{"_id": bson.M{"$in": coverIDs}}))
+		if err == nil {
+			err = coverCursor.All(ctx, &covers)
+		}
+		if err != nil {
+			// Cards are still useful without their covers.
+			log.Println("Error getting category covers:", err)
+		}
+
+		coversByID := make(map[bson.ObjectID]*ImageResponse, len(covers))
+		responseCovers := presignImages(ctx, os.Getenv("BUCKET_NAME"), covers, 60*time.Minute)
+		hideLocations(c, responseCovers)
+		for i, cover := range responseCovers {
+			coversByID[covers[i].ID] = &cover
+		}
+		for i := range cards {
+			if cards[i].CoverImageID != nil {
+				cards[i].Cover = coversByID[*cards[i].CoverImageID]
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"Category": cards, "total": len(cards)})
+}
+
+// UpdateCategory renames a category, changes its slug or moves it under
+// another parent. Paths below it are rewritten to match. A new slug is
+// cascaded to images.category. All of it is one transaction, so MongoDB must
+// run as a replica set (a single node one will do). S3 objects stay where
+// they are: uploads are keyed by image ID, and older keys under a slug
+// prefix are never reused. Moving a subtree needs no image updates because
+// images only reference their own category's slug.
+func UpdateCategory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	slug := c.Param("slug")
+	var update categoryUpdate
+	if err := c.ShouldBind(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	collection := db.Collection("categories")
+
+	var category models.Category
+	err := collection.FindOne(ctx, bson.M{"slug": slug}).Decode(&category)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+		return
+	}
+	oldPath := category.Path
+
+	if name := strings.Join(strings.Fields(update.Category), " "); name != "" {
+		category.Category = name
+	}
+	if newSlug := utils.Slugify(update.Slug); newSlug != "" {
+		category.Slug = newSlug
+	}
+	if update.Description != nil {
+		category.Description = strings.TrimSpace(*update.Description)
+	}
+	if update.Parent != nil {
+		category.Parent = utils.Slugify(*update.Parent)
+	}
+	category.UpdatedAt = time.Now()
+
+	// A category can't be moved below itself.
+	if category.Parent == slug || category.Parent == category.Slug {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A category cannot be its own parent"})
+		return
+	}
+	category.Path, err = categoryPath(ctx, category.Parent, category.Slug)
+	if err == errUnknownParent {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating category"})
+		return
+	}
+	if strings.HasPrefix(category.Path, oldPath+"/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot move a category below one of its subcategories"})
+		return
+	}
+
+	// The category, its subcategories and its images change together, so a
+	// failure part way doesn't leave images under a slug that no longer
+	// exists.
+	session, err := database.Client.StartSession()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating category"})
+		return
+	}
+	defer session.EndSession(ctx)
+
+	moved, err := session.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		_, err := collection.UpdateByID(ctx, category.ID, bson.M{"$set": bson.M{
+			"category":    category.Category,
+			"slug":        category.Slug,
+			"parent":      category.Parent,
+			"path":        category.Path,
+			"description": category.Description,
+			"updated_at":  category.UpdatedAt,
+		}})
+		if err != nil {
+			return nil, err
+		}
+
+		if category.Path != oldPath {
+			// Swap the old path prefix for the new one on every descendant.
+			_, err = collection.UpdateMany(ctx,
+				bson.M{"path": bson.M{"$regex": "^" + regexp.QuoteMeta(oldPath+"/")}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{"path": bson.M{"$concat": bson.A{
+					category.Path,
+					bson.M{"$substrCP": bson.A{"$path", utf8.RuneCountInString(oldPath), bson.M{"$strLenCP": "$path"}}},
+				}}}}}})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if category.Slug == slug {
+			return int64(0), nil
+		}
+		if _, err := collection.UpdateMany(ctx, bson.M{"parent": slug}, bson.M{"$set": bson.M{"parent": category.Slug}}); err != nil {
+			return nil, err
+		}
+		result, err := db.Collection("images").UpdateMany(ctx,
+			bson.M{"category": slug}, bson.M{"$set": bson.M{"category": category.Slug}})
+		if err != nil {
+			return nil, err
+		}
+		return result.ModifiedCount, nil
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category already exists"})
+		return
+	}
+	if err != nil {
+		log.Println("Error updating category", slug, ":", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"category": category, "images_moved": moved})
+}
+
+// DeleteCategory removes an empty category. A category that still has images
+// needs either ?reassign=<slug> to move them to another category or
+// ?cascade=true to delete them too.
+func DeleteCategory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	slug := c.Param("slug")
+	reassign := c.Query("reassign")
+	cascade, _ := strconv.ParseBool(c.Query("cascade"))
+
+	db := database.Client.Database("imagestore")
+	categories := db.Collection("categories")
+	images := db.Collection("images")
+
+	if err := categories.FindOne(ctx, bson.M{"slug": slug}).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+		return
+	}
+
+	children, err := categories.CountDocuments(ctx, bson.M{"parent": slug})
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if children > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Category has subcategories, move or delete them first",
+			"subcategories": children,
+		})
+		return
+	}
+
+	count, err := images.CountDocuments(ctx, bson.M{"category": slug})
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var affected int64
+	switch {
+	case count == 0:
+	case reassign != "":
+		if reassign == slug {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reassign images to the category being deleted"})
+			return
+		}
+		err := categories.FindOne(ctx, bson.M{"slug": reassign}).Err()
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reassign category not found"})
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+			return
+		}
+		result, err := images.UpdateMany(ctx, bson.M{"category": slug}, bson.M{"$set": bson.M{"category": reassign}})
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reassigning images"})
+			return
+		}
+		affected = result.ModifiedCount
+	case cascade:
+		affected, err = deleteImages(ctx, bson.M{"category": slug})
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting images"})
+			return
+		}
+	default:
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Category is not empty, pass reassign=<slug> or cascade=true",
+			"images": count,
+		})
+		return
+	}
+
+	if _, err := categories.DeleteOne(ctx, bson.M{"slug": slug}); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "slug": slug, "images_affected": affected})
+}
+
+// GetCategoryTree returns every category the caller can read nested under its
+// parent.
+func GetCategoryTree(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.Client.Database("imagestore").Collection("categories")
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "path", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return
+	}
+	var categories []models.Category
+	if err = cursor.All(ctx, &categories); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return
+	}
+	// Children of a category the caller can't read move up to the top level.
+	categories = slices.DeleteFunc(categories, func(category models.Category) bool { return !canReadCategory(c, category) })
+
+	nodes := make(map[string]*categoryNode, len(categories))
+	for _, category := range categories {
+		nodes[category.Slug] = &categoryNode{Category: category, Children: []*categoryNode{}}
+	}
+
+	// Sorted by path, so parents are always linked before their children.
+	tree := []*categoryNode{}
+	for _, category := range categories {
+		node := nodes[category.Slug]
+		if parent, ok := nodes[category.Parent]; ok && category.Parent != "" {
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree = append(tree, node)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tree": tree, "total": len(categories)})
+}
+
+// ReorderCategories sets the manual order of categories to the order of the
+// posted slugs. Categories left out keep their current position value.
+func ReorderCategories(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var order struct {
+		Slugs []string `json:"slugs"`
+	}
+	if err := c.ShouldBind(&order); err != nil || len(order.Slugs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "slugs is required"})
+		return
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(order.Slugs))
+	for i, slug := range order.Slugs {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"slug": slug}).
+			SetUpdate(bson.M{"$set": bson.M{"sort_order": i}}))
+	}
+
+	result, err := database.Client.Database("imagestore").Collection("categories").BulkWrite(ctx, writes)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reordering categories"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "matched": result.MatchedCount})
+}
+
+// SetCategoryCover picks one of the category's images as its cover. Posting
+// an empty image_id goes back to the newest image.
+func SetCategoryCover(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slug := c.Param("slug")
+	var cover struct {
+		ImageID string `json:"image_id"`
+	}
+	if err := c.ShouldBind(&cover); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	update := bson.M{"$unset": bson.M{"cover_image_id": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	if cover.ImageID != "" {
+		imageID, err := bson.ObjectIDFromHex(cover.ImageID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+			return
+		}
+		err = db.Collection("images").FindOne(ctx, bson.M{"_id": imageID, "category": slug}).Err()
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Image not found in this category"})
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting image"})
+			return
+		}
+		update = bson.M{"$set": bson.M{"cover_image_id": imageID, "updated_at": time.Now()}}
+	}
+
+	result, err := db.Collection("categories").UpdateOne(ctx, bson.M{"slug": slug}, update)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating category"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true, "slug": slug, "cover_image_id": cover.ImageID})
+}
+
+// validVisibility reports whether visibility is one of the category
+// visibilities.
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case models.CategoryPublic, models.CategoryMembers, models.CategoryRestricted:
+		return true
+	}
+	return false
+}
+
+// categoryAccess is the body of SetCategoryAccess.
+type categoryAccess struct {
+	Visibility   string   `json:"visibility"`
+	AllowedUsers []string `json:"allowed_users"`
+	AllowedRoles []string `json:"allowed_roles"`
+	Contributors []string `json:"contributors"`
+}
+
+// SetCategoryAccess sets who can read a category and who can upload to it
+// besides the users with image:upload. The lists replace the current ones.
+func SetCategoryAccess(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var access categoryAccess
+	if err := c.ShouldBind(&access); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	if !validVisibility(access.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "visibility must be public, members or restricted"})
+		return
+	}
+	if access.Visibility != models.CategoryRestricted && (len(access.AllowedUsers) > 0 || len(access.AllowedRoles) > 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allowed_users and allowed_roles only apply to restricted categories"})
+		return
+	}
+
+	var category models.Category
+	err := database.Client.Database("imagestore").Collection("categories").FindOneAndUpdate(ctx,
+		bson.M{"slug": c.Param("slug")},
+		bson.M{"$set": bson.M{
+			"visibility":    access.Visibility,
+			"allowed_users": uniqueStrings(access.AllowedUsers),
+			"allowed_roles": uniqueStrings(access.AllowedRoles),
+			"contributors":  uniqueStrings(access.Contributors),
+			"updated_at":    time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accessOf(category))
+}
+
+// accessOf is the access response of category. The lists are left out of
+// every other category response.
+func accessOf(category models.Category) gin.H {
+	visibility := category.Visibility
+	if visibility == "" {
+		visibility = models.CategoryMembers
+	}
+	return gin.H{
+		"slug":          category.Slug,
+		"visibility":    visibility,
+		"allowed_users": nonNil(category.AllowedUsers),
+		"allowed_roles": nonNil(category.AllowedRoles),
+		"contributors":  nonNil(category.Contributors),
+	}
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// GetCategoryAccess returns who can read a category and who contributes to
+// it.
+func GetCategoryAccess(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var category models.Category
+	err := database.Client.Database("imagestore").Collection("categories").FindOne(ctx,
+		bson.M{"slug": c.Param("slug")}).Decode(&category)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+		return
+	}
+	c.JSON(http.StatusOK, accessOf(category))
+}
+
+// uniqueStrings trims values and drops empty and repeated ones.
+func uniqueStrings(values []string) []string {
+	unique := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// deleteImages removes the images matching filter from S3 and Mongo and
+// returns how many documents were deleted. Objects that fail to delete from
+// S3 are logged and left behind rather than keeping their documents around.
+func deleteImages(ctx context.Context, filter bson.M) (int64, error) {
+	bucketName := os.Getenv("BUCKET_NAME")
+	collection := database.Client.Database("imagestore").Collection("images")
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"s3_key": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		return 0, err
+	}
+	if len(images) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]bson.ObjectID, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+		_, err := s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(img.S3Key),
+		})
+		if err != nil {
+			log.Println("Error deleting S3 object", img.S3Key, ":", err)
+		}
+	}
+
+	result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, err
+	}
+
+	// Categories using a deleted image as cover fall back to their newest one.
+	_, err = database.Client.Database("imagestore").Collection("categories").UpdateMany(ctx,
+		bson.M{"cover_image_id": bson.M{"$in": ids}}, bson.M{"$unset": bson.M{"cover_image_id": ""}})
+	if err != nil {
+		log.Println("Error clearing category covers:", err)
+	}
+
+	_, err = database.Client.Database("imagestore").Collection("albums").UpdateMany(ctx,
+		bson.M{"image_ids": bson.M{"$in": ids}}, bson.M{"$pull": bson.M{"image_ids": bson.M{"$in": ids}}})
+	if err != nil {
+		log.Println("Error removing images from albums:", err)
+	}
+
+	_, err = database.Client.Database("imagestore").Collection("reactions").DeleteMany(ctx,
+		bson.M{"image_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Println("Error deleting reactions:", err)
+	}
+
+	_, err = database.Client.Database("imagestore").Collection("image_stats").DeleteMany(ctx,
+		bson.M{"image_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Println("Error deleting image stats:", err)
+	}
+
+	_, err = database.Client.Database("imagestore").Collection("comments").DeleteMany(ctx,
+		bson.M{"image_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Println("Error deleting comments:", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// commentFilter is built on first use from COMMENT_BLOCKED_WORDS (comma
+// separated) and COMMENT_ALLOW_LINKS.
+var commentFilter = sync.OnceValue(func() utils.CommentFilter {
+	filters := utils.CommentFilters{}
+	if words := os.Getenv("COMMENT_BLOCKED_WORDS"); words != "" {
+		filters = append(filters, utils.NewWordFilter(strings.Split(words, ",")))
+	}
+	if allowLinks, _ := strconv.ParseBool(os.Getenv("COMMENT_ALLOW_LINKS")); !allowLinks {
+		filters = append(filters, utils.LinkFilter{})
+	}
+	return filters
+})
+
+// commentEditWindow is how long after posting a comment its author may edit
+// it, COMMENT_EDIT_MINUTES (15 by default).
+func commentEditWindow() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("COMMENT_EDIT_MINUTES")); err == nil && minutes >= 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+// bindComment reads and checks the comment body of the request.
+func bindComment(c *gin.Context) (models.Comment, bool) {
+	var comment models.Comment
+	if err := c.ShouldBind(&comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return comment, false
+	}
+	comment.Body = strings.TrimSpace(comment.Body)
+	if err := validator.New().Struct(comment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return comment, false
+	}
+	if err := commentFilter().Check(comment.Body); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return comment, false
+	}
+	return comment, true
+}
+
+// loadComment finds the comment of the request's image, writing a 404 when
+// there is none.
+func loadComment(ctx context.Context, c *gin.Context) (models.Comment, bool) {
+	var comment models.Comment
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return comment, false
+	}
+	commentID, err := bson.ObjectIDFromHex(c.Param("comment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment id"})
+		return comment, false
+	}
+
+	err = database.Client.Database("imagestore").Collection("comments").
+		FindOne(ctx, bson.M{"_id": commentID, "image_id": imageID}).Decode(&comment)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+			return comment, false
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting comment"})
+		return comment, false
+	}
+	return comment, true
+}
+
+// CreateComment adds a comment by the caller to an image.
+func CreateComment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	comment, ok := bindComment(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, ok := visibleImage(ctx, c, imageID); !ok {
+		return
+	}
+	db := database.Client.Database("imagestore")
+	result, err := db.Collection("images").UpdateOne(ctx, bson.M{"_id": imageID}, bson.M{"$inc": bson.M{"comment_count": 1}})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving comment"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+		return
+	}
+
+	comment.ID = bson.NilObjectID
+	comment.ImageID = imageID
+	comment.AuthorID = userID
+	comment.CreatedAt = time.Now()
+	comment.EditedAt = nil
+
+	inserted, err := db.Collection("comments").InsertOne(ctx, comment)
+	if err != nil {
+		log.Println(err)
+		if _, err := db.Collection("images").UpdateOne(ctx,
+			bson.M{"_id": imageID}, bson.M{"$inc": bson.M{"comment_count": -1}}); err != nil {
+			log.Println("Error restoring comment count:", err)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving comment"})
+		return
+	}
+	comment.ID = inserted.InsertedID.(bson.ObjectID)
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// GetComments lists an image's comments, oldest first.
+func GetComments(c *gin.Context) {
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, ok := visibleImage(ctx, c, imageID); !ok {
+		return
+	}
+
+	collection := database.Client.Database("imagestore").Collection("comments")
+	filter := bson.M{"image_id": imageID}
+	page, limit, skip := paginationParams(c)
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting comments"})
+		return
+	}
+	comments := []models.Comment{}
+	if err = cursor.All(ctx, &comments); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments":   comments,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
+
+// UpdateComment lets the author change a comment within the edit window.
+func UpdateComment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	comment, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author can edit a comment"})
+		return
+	}
+	if time.Since(comment.CreatedAt) > commentEditWindow() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Comment can no longer be edited"})
+		return
+	}
+	update, ok := bindComment(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	comment.Body = update.Body
+	comment.EditedAt = &now
+	_, err := database.Client.Database("imagestore").Collection("comments").UpdateOne(ctx,
+		bson.M{"_id": comment.ID}, bson.M{"$set": bson.M{"body": comment.Body, "edited_at": now}})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteComment removes a comment. Authors can delete their own comments and
+// moderators any comment.
+func DeleteComment(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	comment, ok := loadComment(ctx, c)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != userID && !hasPermission(c, models.PermCommentModerate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the author or a moderator can delete a comment"})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	result, err := db.Collection("comments").DeleteOne(ctx, bson.M{"_id": comment.ID})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting comment"})
+		return
+	}
+	if result.DeletedCount == 1 {
+		_, err = db.Collection("images").UpdateOne(ctx,
+			bson.M{"_id": comment.ImageID}, bson.M{"$inc": bson.M{"comment_count": -1}})
+		if err != nil {
+			log.Println("Error updating comment count:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
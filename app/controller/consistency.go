@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// orphanCategory is an images.category value with no matching category.
+type orphanCategory struct {
+	Category string `json:"category" bson:"_id"`
+	Images   int64  `json:"images" bson:"images"`
+}
+
+type categoryRepair struct {
+	// Mode is "create" (default) to create the missing categories, or
+	// "reassign" to move the orphaned images to Target.
+	Mode   string `json:"mode"`
+	Target string `json:"target"`
+	// Categories limits the repair to these orphaned values; empty means all.
+	Categories []string `json:"categories"`
+}
+
+func findOrphanCategories(ctx context.Context) ([]orphanCategory, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$category", "images": bson.M{"$sum": 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "categories",
+			"localField":   "_id",
+			"foreignField": "slug",
+			"as":           "matches",
+		}}},
+		{{Key: "$match", Value: bson.M{"matches": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"images": 1}}},
+		{{Key: "$sort", Value: bson.D{{Key: "images", Value: -1}}}},
+	}
+
+	cursor, err := database.Client.Database("imagestore").Collection("images").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	orphans := []orphanCategory{}
+	if err = cursor.All(ctx, &orphans); err != nil {
+		return nil, err
+	}
+	return orphans, nil
+}
+
+// GetCategoryConsistency reports image category values that don't match any
+// category, with how many images use each.
+func GetCategoryConsistency(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	orphans, err := findOrphanCategories(ctx)
+	if err != nil {
+		log.Println("Mongo aggregate error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking categories"})
+		return
+	}
+
+	var images int64
+	for _, orphan := range orphans {
+		images += orphan.Images
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"consistent":      len(orphans) == 0,
+		"orphans":         orphans,
+		"orphaned_images": images,
+	})
+}
+
+// RepairCategories fixes what GetCategoryConsistency reports, either by
+// creating the missing categories (normalising the values to slugs) or by
+// moving the orphaned images to an existing category.
+func RepairCategories(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var repair categoryRepair
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBind(&repair); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+			return
+		}
+	}
+	if repair.Mode == "" {
+		repair.Mode = "create"
+	}
+	if repair.Mode != "create" && repair.Mode != "reassign" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be create or reassign"})
+		return
+	}
+
+	images := database.Client.Database("imagestore").Collection("images")
+
+	var target string
+	if repair.Mode == "reassign" {
+		category, err := resolveCategory(ctx, repair.Target, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Target category not found"})
+			return
+		}
+		target = category.Slug
+	}
+
+	orphans, err := findOrphanCategories(ctx)
+	if err != nil {
+		log.Println("Mongo aggregate error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking categories"})
+		return
+	}
+
+	only := make(map[string]bool)
+	for _, name := range repair.Categories {
+		only[name] = true
+	}
+
+	repaired := []gin.H{}
+	for _, orphan := range orphans {
+		if len(only) > 0 && !only[orphan.Category] {
+			continue
+		}
+
+		slug := target
+		if repair.Mode == "create" {
+			if utils.Slugify(orphan.Category) == "" {
+				log.Println("Skipping category without a usable name:", orphan.Category)
+				continue
+			}
+			category, err := resolveCategory(ctx, orphan.Category, true)
+			if err != nil {
+				log.Println("Error creating category", orphan.Category, ":", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating category", "repaired": repaired})
+				return
+			}
+			slug = category.Slug
+		}
+
+		// Images without a category at all are grouped under "".
+		filter := bson.M{"category": orphan.Category}
+		if orphan.Category == "" {
+			filter = bson.M{"category": bson.M{"$in": bson.A{nil, ""}}}
+		}
+
+		var moved int64
+		if slug != orphan.Category {
+			result, err := images.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"category": slug}})
+			if err != nil {
+				log.Println("Error moving images from", orphan.Category, ":", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving images", "repaired": repaired})
+				return
+			}
+			moved = result.ModifiedCount
+		}
+		repaired = append(repaired, gin.H{"from": orphan.Category, "to": slug, "images_moved": moved})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": repair.Mode, "repaired": repaired})
+}
@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"errors"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// paletteMinWeight ignores accent colors covering less than this share of an
+// image when filtering by color.
+const paletteMinWeight = 0.1
+
+// excludeHidden restricts filter to images not hidden by a moderator.
+func excludeHidden(filter bson.M) bson.M {
+	filter["hidden"] = bson.M{"$ne": true}
+	return filter
+}
+
+// publishedOnly restricts filter to images anyone can see.
+func publishedOnly(filter bson.M) bson.M {
+	filter["status"] = models.ImagePublished
+	return excludeHidden(filter)
+}
+
+// applyImageFilters restricts filter to visible images and adds the optional
+// query filters shared by the image listing endpoints:
+//
+//	status=                reviewers only: images with this status, all
+//	                       of them by default. Everyone else sees published
+//	                       ones
+//	uploaded_by=           images uploaded by this user ID
+//	color=#hex&tolerance=  images with a dominant color within tolerance
+//	                       (CIE76 delta E, default 20) of color
+//	from=&to=              images dated within the range, both inclusive
+//	date_field=            uploaded_at (default) or taken_at, the date the
+//	                       range applies to
+func applyImageFilters(c *gin.Context, filter bson.M) error {
+	if !hasPermission(c, models.PermImageReview) {
+		publishedOnly(filter)
+	} else {
+		excludeHidden(filter)
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+	}
+
+	if uploadedBy := c.Query("uploaded_by"); uploadedBy != "" {
+		filter["uploaded_by"] = uploadedBy
+	}
+
+	dateField, err := dateFieldParam(c)
+	if err != nil {
+		return err
+	}
+	dateRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		start, _, err := parseDateParam(from)
+		if err != nil {
+			return errors.New("from must be a date like 2024-05-01 or an RFC 3339 time")
+		}
+		dateRange["$gte"] = start
+	}
+	if to := c.Query("to"); to != "" {
+		end, dateOnly, err := parseDateParam(to)
+		if err != nil {
+			return errors.New("to must be a date like 2024-05-31 or an RFC 3339 time")
+		}
+		// A plain date includes the whole day.
+		if dateOnly {
+			dateRange["$lt"] = end.AddDate(0, 0, 1)
+		} else {
+			dateRange["$lte"] = end
+		}
+	}
+	if len(dateRange) > 0 {
+		filter[dateField] = dateRange
+	}
+
+	if color := c.Query("color"); color != "" {
+		r, g, b, err := utils.ParseHexColor(color)
+		if err != nil {
+			return err
+		}
+		tolerance := 20.0
+		if raw := c.Query("tolerance"); raw != "" {
+			tolerance, err = strconv.ParseFloat(raw, 64)
+			if err != nil || tolerance <= 0 || tolerance > 100 {
+				return errors.New("tolerance must be a number between 0 and 100")
+			}
+		}
+		filter["$expr"] = colorMatchExpr(r, g, b, tolerance)
+	}
+	return nil
+}
+
+// colorMatchExpr matches images with a palette color heavier than
+// paletteMinWeight whose Lab distance to r, g, b is at most tolerance.
+func colorMatchExpr(r, g, b uint8, tolerance float64) bson.M {
+	l, la, lb := utils.RGBToLab(r, g, b)
+	square := func(field string, value float64) bson.M {
+		return bson.M{"$pow": bson.A{bson.M{"$subtract": bson.A{"$$swatch." + field, value}}, 2}}
+	}
+
+	return bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$palette", bson.A{}}},
+		"as":    "swatch",
+		"in": bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{"$$swatch.weight", paletteMinWeight}},
+			bson.M{"$lte": bson.A{
+				bson.M{"$sqrt": bson.M{"$add": bson.A{square("l", l), square("a", la), square("b", lb)}}},
+				tolerance,
+			}},
+		}},
+	}}}}
+}
+
+// dateFieldParam returns the image field named by date_field.
+func dateFieldParam(c *gin.Context) (string, error) {
+	switch field := c.DefaultQuery("date_field", "uploaded_at"); field {
+	case "uploaded_at", "taken_at":
+		return field, nil
+	default:
+		return "", errors.New("date_field must be uploaded_at or taken_at")
+	}
+}
+
+// parseDateParam accepts a plain date (2024-05-01, taken as UTC midnight) or
+// an RFC 3339 time, and reports which one it was.
+func parseDateParam(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, raw); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	return t, false, err
+}
@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	earthRadiusMeters = 6378100
+	// maxNearRadius keeps radius searches to a sensible area (1000 km).
+	maxNearRadius = 1_000_000
+)
+
+// geoSharing reports whether image locations are shown to everyone,
+// GEO_SHARING=true. Otherwise only the uploader and moderators see them.
+func geoSharing() bool {
+	return os.Getenv("GEO_SHARING") == "true"
+}
+
+// canSeeLocations reports whether the caller may see where images uploaded
+// by uploadedBy were taken.
+func canSeeLocations(c *gin.Context, uploadedBy string) bool {
+	if geoSharing() || hasPermission(c, models.PermImageModerate) {
+		return true
+	}
+	userID := principal(c).UserID
+	return userID != "" && userID == uploadedBy
+}
+
+// hideLocations clears the locations of images the caller may not see.
+func hideLocations(c *gin.Context, images []ImageResponse) {
+	for i := range images {
+		if !canSeeLocations(c, images[i].UploadedBy) {
+			images[i].Location = nil
+		}
+	}
+}
+
+// ownLocationsOnly restricts a location search to images whose location the
+// caller may see, so searches can't be used to find where others' photos
+// were taken. uploaded_by is never stored empty, so anonymous callers get
+// nothing.
+func ownLocationsOnly(c *gin.Context, filter bson.M) {
+	if !geoSharing() && !hasPermission(c, models.PermImageModerate) {
+		filter["uploaded_by"] = principal(c).UserID
+	}
+}
+
+// GetImagesNear lists located images within radius meters (default 5000) of
+// lat/lng, nearest first.
+func GetImagesNear(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, errLng := strconv.ParseFloat(c.Query("lng"), 64)
+	if errLat != nil || errLng != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must be valid coordinates"})
+		return
+	}
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "5000"), 64)
+	if err != nil || radius <= 0 || radius > maxNearRadius {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "radius must be between 0 and 1000000 meters"})
+		return
+	}
+
+	filter := bson.M{}
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+	ownLocationsOnly(c, filter)
+	page, limit, skip := paginationParams(c)
+	bucketName := os.Getenv("BUCKET_NAME")
+	collection := database.Client.Database("imagestore").Collection("images")
+
+	// $geoNear can't be used to count, so count with the equivalent $geoWithin.
+	countFilter := bson.M{"location": bson.M{"$geoWithin": bson.M{
+		"$centerSphere": bson.A{bson.A{lng, lat}, radius / earthRadiusMeters},
+	}}}
+	for key, value := range filter {
+		countFilter[key] = value
+	}
+	total, err := collection.CountDocuments(ctx, countFilter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$geoNear", Value: bson.M{
+			"near":          models.NewGeoPoint(lat, lng),
+			"distanceField": "distance",
+			"maxDistance":   radius,
+			"spherical":     true,
+			"query":         filter,
+		}}},
+		{{Key: "$skip", Value: skip}},
+		{{Key: "$limit", Value: limit}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("Mongo aggregate error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing images"})
+		return
+	}
+
+	respondImages(c, presignImages(ctx, bucketName, images, 10*time.Minute), total, page, limit)
+}
+
+// GetImagesWithin lists located images inside bbox=minLng,minLat,maxLng,maxLat,
+// newest first.
+func GetImagesWithin(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	polygon, err := parseBBox(c.Query("bbox"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := bson.M{"location": bson.M{"$geoWithin": bson.M{"$geometry": polygon}}}
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+	ownLocationsOnly(c, filter)
+	page, limit, skip := paginationParams(c)
+	bucketName := os.Getenv("BUCKET_NAME")
+	collection := database.Client.Database("imagestore").Collection("images")
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploaded_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing images"})
+		return
+	}
+
+	respondImages(c, presignImages(ctx, bucketName, images, 10*time.Minute), total, page, limit)
+}
+
+// parseBBox turns "minLng,minLat,maxLng,maxLat" into a GeoJSON polygon.
+func parseBBox(raw string) (bson.M, error) {
+	invalid := errors.New("bbox must be minLng,minLat,maxLng,maxLat")
+
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return nil, invalid
+	}
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, invalid
+		}
+		v[i] = f
+	}
+	minLng, minLat, maxLng, maxLat := v[0], v[1], v[2], v[3]
+	if minLng >= maxLng || minLat >= maxLat || minLng < -180 || maxLng > 180 || minLat < -90 || maxLat > 90 {
+		return nil, invalid
+	}
+
+	return bson.M{
+		"type": "Polygon",
+		"coordinates": bson.A{bson.A{
+			bson.A{minLng, minLat},
+			bson.A{maxLng, minLat},
+			bson.A{maxLng, maxLat},
+			bson.A{minLng, maxLat},
+			bson.A{minLng, minLat},
+		}},
+	}, nil
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseBBox(t *testing.T) {
+	got, err := parseBBox(" 2.2,48.8, 2.5,49 ")
+	want := bson.A{bson.A{
+		bson.A{2.2, 48.8}, bson.A{2.5, 48.8}, bson.A{2.5, 49.0}, bson.A{2.2, 49.0}, bson.A{2.2, 48.8},
+	}}
+	if err != nil || got["type"] != "Polygon" || !reflect.DeepEqual(got["coordinates"], want) {
+		t.Errorf("parseBBox = %v, %v, want a Polygon of %v", got, err, want)
+	}
+
+	for _, raw := range []string{"", "1,2,3", "a,2,3,4", "3,2,1,4", "1,4,3,2", "-181,0,1,1", "0,0,1,91"} {
+		if _, err := parseBBox(raw); err == nil {
+			t.Errorf("parseBBox(%q) accepted an invalid box", raw)
+		}
+	}
+}
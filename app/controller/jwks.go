@@ -0,0 +1,21 @@
+package controller
+
+import (
+	"ginmongo/utils"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys access tokens are signed with.
+func GetJWKS(c *gin.Context) {
+	keys, err := utils.JWKS()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading keys"})
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
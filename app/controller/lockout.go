@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// maxLoginDelay caps the wait between failed logins of an account before it
+// is locked.
+const maxLoginDelay = 30 * time.Second
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// loginMaxFailures is how many failed logins lock an account,
+// LOGIN_MAX_FAILURES (5 by default).
+func loginMaxFailures() int { return envInt("LOGIN_MAX_FAILURES", 5) }
+
+// loginMaxIPFailures is how many failed logins from one IP address, whatever
+// the accounts, block further logins from it, LOGIN_MAX_IP_FAILURES (20 by
+// default).
+func loginMaxIPFailures() int { return envInt("LOGIN_MAX_IP_FAILURES", 20) }
+
+// loginLockout is how long failures are counted and how long a lockout
+// lasts, LOGIN_LOCKOUT_MINUTES (15 by default).
+func loginLockout() time.Duration {
+	return time.Duration(envInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+// loginDelay is how long an account has to wait after its count-th failed
+// login: 1s, 2s, 4s and so on, up to maxLoginDelay.
+func loginDelay(count int) time.Duration {
+	if count <= 0 {
+		return 0
+	}
+	return min(time.Second<<min(count-1, 16), maxLoginDelay)
+}
+
+// accountKey and ipKey are the auth_failures keys of login failures. The
+// account key uses the email as typed, so unknown emails are throttled the
+// same way as known ones.
+func accountKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string { return "login:ip:" + ip }
+
+// dummyHash is compared against when the email is unknown, so that a login
+// takes as long whether or not the account exists.
+var dummyHash = sync.OnceValue(func() string {
+	hash, err := utils.HashPass("not a real password")
+	if err != nil {
+		log.Println("Error hashing dummy password:", err)
+	}
+	return hash
+})
+
+func retryAfter(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+}
+
+// accountWait decides on a login whose check has been counted in failure:
+// the account is locked once more than maxFailures were counted, otherwise
+// the login has to wait loginDelay after the previous one.
+func accountWait(failure models.AuthFailure, maxFailures int, now time.Time) (locked bool, wait time.Duration) {
+	if failure.Count > maxFailures {
+		return true, failure.ExpiresAt.Sub(now)
+	}
+	if failure.PreviousAt == nil {
+		return false, 0
+	}
+	return false, max(loginDelay(failure.Count-1)-now.Sub(*failure.PreviousAt), 0)
+}
+
+// loginAttempt counts a login against the IP address and the account before
+// the password is checked, so parallel logins each get their own count. It
+// writes a 429 and returns false when the IP address or the account has
+// failed too often, or the account has to wait before its next try.
+func loginAttempt(ctx context.Context, c *gin.Context, email string) (models.AuthFailure, bool) {
+	byIP, err := recordFailure(ctx, ipKey(c.ClientIP()), loginLockout())
+	if err != nil {
+		log.Println("Error recording login attempt:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return byIP, false
+	}
+	if byIP.Count > loginMaxIPFailures() {
+		turnedAway(ctx, byIP.Key)
+		retryAfter(c, time.Until(byIP.ExpiresAt))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, try again later"})
+		return byIP, false
+	}
+
+	byAccount, err := recordFailure(ctx, accountKey(email), loginLockout())
+	if err != nil {
+		log.Println("Error recording login attempt:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return byAccount, false
+	}
+	locked, wait := accountWait(byAccount, loginMaxFailures(), time.Now())
+	if locked {
+		turnedAway(ctx, byIP.Key, byAccount.Key)
+		retryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Account is locked after too many failed logins, try again later"})
+		return byAccount, false
+	}
+	if wait > 0 {
+		turnedAway(ctx, byIP.Key, byAccount.Key)
+		retryAfter(c, wait)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, try again later"})
+		return byAccount, false
+	}
+	return byAccount, true
+}
+
+// turnedAway takes back the counts of a login refused before its password
+// was checked, so that only checked passwords count toward a lockout.
+func turnedAway(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if err := forgiveFailure(ctx, key); err != nil {
+			log.Println("Error taking back login attempt:", err)
+		}
+	}
+}
+
+// loginFailed writes the 401 every wrong email or password gets, locking the
+// account if attempt was its last try.
+func loginFailed(ctx context.Context, c *gin.Context, attempt models.AuthFailure, email string) {
+	lockAtLimit(ctx, c, attempt, email)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+}
+
+// loginSucceeded clears the failures of the account and takes the login back
+// from the IP address's count.
+func loginSucceeded(ctx context.Context, c *gin.Context, email string) {
+	if err := clearFailures(ctx, accountKey(email)); err != nil {
+		log.Println("Error clearing login failures:", err)
+	}
+	if err := forgiveFailure(ctx, ipKey(c.ClientIP())); err != nil {
+		log.Println("Error clearing login failures:", err)
+	}
+}
+
+// lockAtLimit locks the account for loginLockout when attempt, which didn't
+// succeed, was the loginMaxFailures-th, and emails its owner.
+func lockAtLimit(ctx context.Context, c *gin.Context, attempt models.AuthFailure, email string) {
+	if attempt.Count != loginMaxFailures() {
+		return
+	}
+	until := time.Now().Add(loginLockout())
+	if err := extendFailures(ctx, attempt.Key, until); err != nil {
+		log.Println("Error locking account:", err)
+	}
+	go sendLockoutEmail(email, c.ClientIP(), until)
+}
+
+// sendLockoutEmail tells the owner of an account that it has been locked.
+// Nothing is sent when no account has that email.
+func sendLockoutEmail(email, ip string, until time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOne(ctx,
+		bson.M{"email": email}, options.FindOne().SetProjection(bson.M{"email": 1})).Decode(user)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("Error getting locked user:", err)
+		}
+		return
+	}
+
+	message := fmt.Sprintf("Your account was locked after %d failed logins, the last one from %s. You can log in again after %s.\n If this wasn't you, consider resetting your password: \n%v/forgetpassword\n",
+		loginMaxFailures(), ip, until.UTC().Format(time.RFC1123), os.Getenv("FRONTEND_URI"))
+	if err := utils.SendMail(user.Email, "Your account has been locked", message); err != nil {
+		log.Println("Error sending lockout email:", err)
+	}
+}
+
+// UnlockUser lifts the login lockout of a user and resets their failed
+// login count.
+func UnlockUser(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOne(ctx,
+		bson.M{"user_id": c.Param("id")}, options.FindOne().SetProjection(bson.M{"email": 1})).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return
+	}
+
+	if err = clearFailures(ctx, accountKey(user.Email)); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unlocking user"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"ginmongo/models"
+	"testing"
+	"time"
+)
+
+func TestAccountWait(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	expires := now.Add(10 * time.Minute)
+
+	tests := []struct {
+		name       string
+		failure    models.AuthFailure
+		wantLocked bool
+		wantWait   time.Duration
+	}{
+		{"first try", models.AuthFailure{Count: 1, ExpiresAt: expires}, false, 0},
+		{"second try after the delay", models.AuthFailure{Count: 2, PreviousAt: ago(2 * time.Second), ExpiresAt: expires}, false, 0},
+		{"fourth try too soon", models.AuthFailure{Count: 4, PreviousAt: ago(time.Second), ExpiresAt: expires}, false, 3 * time.Second},
+		// Parallel logins are counted one after the other, so the ones past
+		// the limit are locked out whatever their timing.
+		{"over the limit", models.AuthFailure{Count: 9, PreviousAt: ago(0), ExpiresAt: expires}, true, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		locked, wait := accountWait(tt.failure, 5, now)
+		if locked != tt.wantLocked || wait != tt.wantWait {
+			t.Errorf("%s: accountWait = %v, %v, want %v, %v", tt.name, locked, wait, tt.wantLocked, tt.wantWait)
+		}
+	}
+}
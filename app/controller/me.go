@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Password checks of signed in users, when changing their password or email,
+// are limited to passwordCheckLimit failures per passwordCheckWindow, so a
+// stolen token can't be used to guess the password.
+const (
+	passwordCheckLimit  = 5
+	passwordCheckWindow = 15 * time.Minute
+)
+
+// checkCurrentPassword compares password with user's, writing a 400 when it
+// is wrong and a 429 once too many checks have failed. Every check is counted
+// before it is made, so parallel requests can't all slip under the limit;
+// a correct password clears the count.
+func checkCurrentPassword(ctx context.Context, c *gin.Context, user *models.User, password string) bool {
+	key := "password:" + user.UserID
+	failure, err := recordFailure(ctx, key, passwordCheckWindow)
+	if err != nil {
+		log.Println("Error recording password check:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return false
+	}
+	if failure.Count > passwordCheckLimit {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(failure.ExpiresAt).Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many incorrect passwords, try again later"})
+		return false
+	}
+
+	if password == "" || utils.ComparePass(password, user.Password) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect Password"})
+		return false
+	}
+
+	if err := clearFailures(ctx, key); err != nil {
+		log.Println("Error clearing password failures:", err)
+	}
+	return true
+}
+
+// loadMe returns the caller's user document without its secrets, writing an
+// error response when it can't.
+func loadMe(ctx context.Context, c *gin.Context) (*models.User, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOne(ctx,
+		bson.M{"user_id": userID}, options.FindOne().SetProjection(userProjection)).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return nil, false
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return nil, false
+	}
+	return user, true
+}
+
+// GetMe returns the caller's profile.
+func GetMe(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := loadMe(ctx, c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// profileUpdate is the body of UpdateMe. Fields left out are unchanged.
+type profileUpdate struct {
+	FirstName *string `json:"first_name"`
+	LastName  *string `json:"last_name"`
+}
+
+// UpdateMe changes the caller's first and last name. The new name shows up in
+// access tokens issued from then on.
+func UpdateMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var body profileUpdate
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	set := bson.M{"updated_at": time.Now()}
+	for field, value := range map[string]*string{"first_name": body.FirstName, "last_name": body.LastName} {
+		if value == nil {
+			continue
+		}
+		name := strings.Join(strings.Fields(*value), " ")
+		if name == "" || len(name) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": field + " must be 1 to 100 characters"})
+			return
+		}
+		set[field] = name
+	}
+	if len(set) == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "first_name or last_name is required"})
+		return
+	}
+
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(userProjection)).Decode(user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// emailChange is the body of ChangeEmail.
+type emailChange struct {
+	Email           string `json:"email" validate:"required,email"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+}
+
+// ChangeEmail starts moving the caller to a new email address. The current
+// address keeps working until the link sent to the new one is used.
+func ChangeEmail(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var body emailChange
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	body.Email = strings.TrimSpace(body.Email)
+	if err := validator.New().Struct(body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+
+	collection := database.Client.Database("imagestore").Collection("users")
+	user := &models.User{}
+	if err := collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(user); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting user"})
+		return
+	}
+	if !checkCurrentPassword(ctx, c, user, body.CurrentPassword) {
+		return
+	}
+	if body.Email == user.Email {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "That is already your email address"})
+		return
+	}
+
+	taken, err := collection.CountDocuments(ctx, bson.M{"email": body.Email})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check existing user"})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+		return
+	}
+
+	_, err = collection.UpdateOne(ctx, bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"pending_email": body.Email, "updated_at": time.Now()}})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	if err = sendVerificationEmail(ctx, user, body.Email); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending mail"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Check your new email address for the verification link", "pending_email": body.Email})
+}
@@ -0,0 +1,350 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/middlewares"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ReportImage flags an image for the moderation queue. Each user can have one
+// open report per image.
+func ReportImage(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var report models.Report
+	if err := c.ShouldBind(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	report.Note = strings.TrimSpace(report.Note)
+	if err := validator.New().Struct(report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	filter := publishedOnly(bson.M{"_id": imageID})
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+	if err := db.Collection("images").FindOne(ctx, filter).Err(); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting image"})
+		return
+	}
+
+	report.ID = bson.NilObjectID
+	report.ImageID = imageID
+	report.ReporterID = userID
+	report.Status = models.ReportOpen
+	report.CreatedAt = time.Now()
+	report.ResolvedAt = nil
+	report.ResolvedBy = ""
+
+	result, err := db.Collection("reports").InsertOne(ctx, report)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "You already reported this image"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving report"})
+		return
+	}
+	report.ID = result.InsertedID.(bson.ObjectID)
+
+	c.JSON(http.StatusOK, report)
+}
+
+// moderationItem is one image of the moderation queue with its reports.
+type moderationItem struct {
+	ImageID       bson.ObjectID   `json:"image_id" bson:"_id"`
+	ReportCount   int64           `json:"report_count" bson:"report_count"`
+	Reasons       []string        `json:"reasons" bson:"reasons"`
+	FirstReported time.Time       `json:"first_reported_at" bson:"first_reported_at"`
+	LastReported  time.Time       `json:"last_reported_at" bson:"last_reported_at"`
+	Reports       []models.Report `json:"reports" bson:"reports"`
+	Image         *ImageResponse  `json:"image,omitempty" bson:"-"`
+}
+
+// GetModerationQueue lists reported images, most reported first. Filters:
+// status (open by default), reason, category and min_reports.
+func GetModerationQueue(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	reportFilter := bson.M{"status": c.DefaultQuery("status", models.ReportOpen)}
+	if reason := c.Query("reason"); reason != "" {
+		reportFilter["reason"] = reason
+	}
+	imageFilter := bson.M{}
+	if category := c.Query("category"); category != "" {
+		imageFilter["image.category"] = utils.Slugify(category)
+	}
+	minReports, err := strconv.Atoi(c.DefaultQuery("min_reports", "1"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "min_reports must be a number"})
+		return
+	}
+	page, limit, skip := paginationParams(c)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: reportFilter}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               "$image_id",
+			"report_count":      bson.M{"$sum": 1},
+			"reasons":           bson.M{"$addToSet": "$reason"},
+			"first_reported_at": bson.M{"$first": "$created_at"},
+			"last_reported_at":  bson.M{"$last": "$created_at"},
+			"reports":           bson.M{"$push": "$$ROOT"},
+		}}},
+		{{Key: "$match", Value: bson.M{"report_count": bson.M{"$gte": minReports}}}},
+		{{Key: "$lookup", Value: bson.M{"from": "images", "localField": "_id", "foreignField": "_id", "as": "image"}}},
+		{{Key: "$unwind", Value: "$image"}},
+		{{Key: "$match", Value: imageFilter}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"items": bson.A{
+				bson.M{"$sort": bson.D{{Key: "report_count", Value: -1}, {Key: "first_reported_at", Value: 1}}},
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+			},
+		}}},
+	}
+
+	cursor, err := database.Client.Database("imagestore").Collection("reports").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting reports"})
+		return
+	}
+	var results []struct {
+		Total []struct{ Count int64 } `bson:"total"`
+		Items []struct {
+			moderationItem `bson:",inline"`
+			Image          models.Image `bson:"image"`
+		} `bson:"items"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting reports"})
+		return
+	}
+
+	var total int64
+	items := []moderationItem{}
+	if len(results) > 0 {
+		if len(results[0].Total) > 0 {
+			total = results[0].Total[0].Count
+		}
+		images := make([]models.Image, 0, len(results[0].Items))
+		for _, item := range results[0].Items {
+			images = append(images, item.Image)
+		}
+		responseImages := presignImages(ctx, os.Getenv("BUCKET_NAME"), images, 10*time.Minute)
+		for i, item := range results[0].Items {
+			item.moderationItem.Image = &responseImages[i]
+			items = append(items, item.moderationItem)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":      items,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
+
+// ModerateImage applies an admin action to an image, resolves its open
+// reports and records the action in the audit trail:
+//
+//	dismiss       close the reports, leaving the image as it is
+//	hide          hide the image from every listing
+//	unhide        show a hidden image again
+//	delete        delete the image
+//	ban_uploader  disable the uploader's account and hide all their images
+func ModerateImage(c *gin.Context) {
+	actorID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	imageID, err := bson.ObjectIDFromHex(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var action models.ModerationAction
+	if err := c.ShouldBind(&action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	action.Note = strings.TrimSpace(action.Note)
+	if err := validator.New().Struct(action); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+
+	if action.Action == models.ModerationDelete && !hasPermission(c, models.PermImageDelete) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission " + models.PermImageDelete})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	images := db.Collection("images")
+
+	var image models.Image
+	if err := images.FindOne(ctx, bson.M{"_id": imageID}).Decode(&image); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting image"})
+		return
+	}
+
+	switch action.Action {
+	case models.ModerationHide:
+		_, err = images.UpdateOne(ctx, bson.M{"_id": imageID}, bson.M{"$set": bson.M{"hidden": true}})
+	case models.ModerationUnhide:
+		_, err = images.UpdateOne(ctx, bson.M{"_id": imageID}, bson.M{"$unset": bson.M{"hidden": ""}})
+	case models.ModerationDelete:
+		_, err = deleteImages(ctx, bson.M{"_id": imageID})
+	case models.ModerationBan:
+		if image.UploadedBy == "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Image has no known uploader"})
+			return
+		}
+		action.TargetUserID = image.UploadedBy
+		_, err = db.Collection("users").UpdateOne(ctx,
+			bson.M{"user_id": image.UploadedBy}, bson.M{"$set": bson.M{"disabled": true, "updated_at": time.Now()}})
+		if err == nil {
+			middlewares.InvalidateDisabledUsers()
+			_, err = revokeSessions(ctx, bson.M{"user_id": image.UploadedBy})
+		}
+		if err == nil {
+			_, err = images.UpdateMany(ctx, bson.M{"uploaded_by": image.UploadedBy}, bson.M{"$set": bson.M{"hidden": true}})
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying " + action.Action})
+		return
+	}
+
+	status := models.ReportActioned
+	if action.Action == models.ModerationDismiss {
+		status = models.ReportDismissed
+	}
+	now := time.Now()
+	resolved, err := db.Collection("reports").UpdateMany(ctx,
+		bson.M{"image_id": imageID, "status": models.ReportOpen},
+		bson.M{"$set": bson.M{"status": status, "resolved_at": now, "resolved_by": actorID}})
+	if err != nil {
+		log.Println("Error resolving reports:", err)
+	} else {
+		action.Reports = resolved.ModifiedCount
+	}
+
+	action.ID = bson.NilObjectID
+	action.ActorID = actorID
+	action.ImageID = imageID
+	action.CreatedAt = now
+	result, err := db.Collection("moderation_audit").InsertOne(ctx, action)
+	if err != nil {
+		// The action itself went through, so don't report it as failed.
+		log.Println("Error recording moderation action:", err)
+	} else {
+		action.ID = result.InsertedID.(bson.ObjectID)
+	}
+
+	c.JSON(http.StatusOK, action)
+}
+
+// GetModerationAudit lists moderation actions, newest first, optionally
+// filtered by action, actor_id, image_id or target_user_id.
+func GetModerationAudit(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{}
+	for _, field := range []string{"action", "actor_id", "target_user_id"} {
+		if value := c.Query(field); value != "" {
+			filter[field] = value
+		}
+	}
+	if raw := c.Query("image_id"); raw != "" {
+		imageID, err := bson.ObjectIDFromHex(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+			return
+		}
+		filter["image_id"] = imageID
+	}
+
+	collection := database.Client.Database("imagestore").Collection("moderation_audit")
+	page, limit, skip := paginationParams(c)
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting audit trail"})
+		return
+	}
+	actions := []models.ModerationAction{}
+	if err = cursor.All(ctx, &actions); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting audit trail"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions":    actions,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	})
+}
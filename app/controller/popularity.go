@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// downloadWeight is how many views a download is worth in the popularity score.
+const downloadWeight = 3
+
+// popularityWindows are the trending windows accepted by GetPopularImages.
+var popularityWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+type statKey struct {
+	imageID bson.ObjectID
+	hour    time.Time
+}
+
+type statCounts struct {
+	views     int64
+	downloads int64
+}
+
+// eventKey identifies one viewer's view or download of an image.
+type eventKey struct {
+	imageID  bson.ObjectID
+	viewer   string
+	download bool
+}
+
+// pendingStats buffers view and download events in memory until the next
+// flush, so recording one is a map update rather than a database write.
+// Each viewer counts once per image and flush. Events still buffered when
+// the process dies are lost.
+var pendingStats = struct {
+	sync.Mutex
+	counts map[statKey]*statCounts
+	seen   map[eventKey]bool
+}{counts: make(map[statKey]*statCounts), seen: make(map[eventKey]bool)}
+
+// recordImageEvent counts a view or download of an image by viewer, a user
+// ID or an IP address, unless they were already counted since the last
+// flush.
+func recordImageEvent(imageID bson.ObjectID, viewer string, download bool) {
+	key := statKey{imageID: imageID, hour: time.Now().UTC().Truncate(time.Hour)}
+	event := eventKey{imageID: imageID, viewer: viewer, download: download}
+
+	pendingStats.Lock()
+	defer pendingStats.Unlock()
+	if pendingStats.seen[event] {
+		return
+	}
+	pendingStats.seen[event] = true
+
+	counts, ok := pendingStats.counts[key]
+	if !ok {
+		counts = &statCounts{}
+		pendingStats.counts[key] = counts
+	}
+	if download {
+		counts.downloads++
+	} else {
+		counts.views++
+	}
+}
+
+// viewer identifies the caller for recordImageEvent.
+func viewer(c *gin.Context) string {
+	if userID := principal(c).UserID; userID != "" {
+		return userID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// InitStatsFlusher starts writing buffered view and download events to Mongo
+// every STATS_FLUSH_SECONDS (10 by default).
+func InitStatsFlusher() {
+	interval := 10 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("STATS_FLUSH_SECONDS")); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := flushImageStats(); err != nil {
+				log.Println("Error flushing image stats:", err)
+			}
+		}
+	}()
+}
+
+// flushImageStats adds the buffered events to the image counters and their
+// hourly rollups in one bulk write per collection. Counts that fail to be
+// written are dropped, and the error says how many.
+func flushImageStats() error {
+	pendingStats.Lock()
+	counts := pendingStats.counts
+	pendingStats.counts = make(map[statKey]*statCounts)
+	pendingStats.seen = make(map[eventKey]bool)
+	pendingStats.Unlock()
+
+	if len(counts) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	totals := make(map[bson.ObjectID]*statCounts)
+	rollups := make([]mongo.WriteModel, 0, len(counts))
+	for key, count := range counts {
+		rollups = append(rollups, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"image_id": key.imageID, "hour": key.hour}).
+			SetUpdate(bson.M{"$inc": bson.M{"views": count.views, "downloads": count.downloads}}).
+			SetUpsert(true))
+
+		total, ok := totals[key.imageID]
+		if !ok {
+			total = &statCounts{}
+			totals[key.imageID] = total
+		}
+		total.views += count.views
+		total.downloads += count.downloads
+	}
+
+	counters := make([]mongo.WriteModel, 0, len(totals))
+	for imageID, total := range totals {
+		counters = append(counters, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": imageID}).
+			SetUpdate(bson.M{"$inc": bson.M{"view_count": total.views, "download_count": total.downloads}}))
+	}
+
+	// The two writes are independent, so one failing doesn't lose the
+	// other's counts.
+	db := database.Client.Database("imagestore")
+	unordered := options.BulkWrite().SetOrdered(false)
+	var errs []error
+	if _, err := db.Collection("images").BulkWrite(ctx, counters, unordered); err != nil {
+		errs = append(errs, fmt.Errorf("image counters of %d images: %w", len(counters), err))
+	}
+	if _, err := db.Collection("image_stats").BulkWrite(ctx, rollups, unordered); err != nil {
+		errs = append(errs, fmt.Errorf("%d hourly rollups: %w", len(rollups), err))
+	}
+	return errors.Join(errs...)
+}
+
+// visibleImage returns the image the caller asked for, if they can see it,
+// writing a 404 otherwise.
+func visibleImage(ctx context.Context, c *gin.Context, imageID bson.ObjectID) (*models.Image, bool) {
+	filter := bson.M{"_id": imageID}
+	if !hasPermission(c, models.PermImageReview) {
+		publishedOnly(filter)
+	}
+	if !readableOnly(ctx, c, filter) {
+		return nil, false
+	}
+	image := &models.Image{}
+	err := database.Client.Database("imagestore").Collection("images").FindOne(ctx, filter).Decode(image)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return nil, false
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting image"})
+		return nil, false
+	}
+	return image, true
+}
+
+// RecordImageView counts a view of an image, e.g. when a client opens it
+// full size. Listings don't count as views.
+func RecordImageView(c *gin.Context) {
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, ok := visibleImage(ctx, c, imageID); !ok {
+		return
+	}
+	recordImageEvent(imageID, viewer(c), false)
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadImage counts a download and redirects to a pre-signed URL that
+// makes the browser save the file.
+func DownloadImage(c *gin.Context) {
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	image, ok := visibleImage(ctx, c, imageID)
+	if !ok {
+		return
+	}
+
+	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(os.Getenv("BUCKET_NAME")),
+		Key:                        aws.String(image.S3Key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", image.FileName)),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = 5 * time.Minute
+	})
+	if err != nil {
+		log.Println("Error generating pre-signed URL:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating download URL"})
+		return
+	}
+
+	recordImageEvent(imageID, viewer(c), true)
+	c.Redirect(http.StatusFound, request.URL)
+}
+
+// GetPopularImages ranks images by their views and downloads over window
+// (24h, 7d or 30d), optionally within a single category.
+func GetPopularImages(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	window, ok := popularityWindows[c.DefaultQuery("window", "24h")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be one of 24h, 7d or 30d"})
+		return
+	}
+	since := time.Now().UTC().Add(-window).Truncate(time.Hour)
+	page, limit, skip := paginationParams(c)
+
+	imageMatch := bson.M{"image.status": models.ImagePublished, "image.hidden": bson.M{"$ne": true}}
+	if category := c.Query("category"); category != "" {
+		imageMatch["image.category"] = utils.Slugify(category)
+	}
+	readable, err := readableCategories(ctx, c)
+	if err != nil {
+		log.Println("Error getting category access:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return
+	}
+	inCategories(imageMatch, "image.category", readable)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"hour": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$image_id",
+			"views":     bson.M{"$sum": "$views"},
+			"downloads": bson.M{"$sum": "$downloads"},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"score": bson.M{"$add": bson.A{"$views", bson.M{"$multiply": bson.A{"$downloads", downloadWeight}}}},
+		}}},
+		{{Key: "$lookup", Value: bson.M{"from": "images", "localField": "_id", "foreignField": "_id", "as": "image"}}},
+		{{Key: "$unwind", Value: "$image"}},
+		{{Key: "$match", Value: imageMatch}},
+		{{Key: "$facet", Value: bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"images": bson.A{
+				bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: -1}}},
+				bson.M{"$skip": skip},
+				bson.M{"$limit": limit},
+				bson.M{"$replaceRoot": bson.M{"newRoot": "$image"}},
+			},
+		}}},
+	}
+
+	cursor, err := database.Client.Database("imagestore").Collection("image_stats").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting popular images"})
+		return
+	}
+	var results []struct {
+		Total  []struct{ Count int64 } `bson:"total"`
+		Images []models.Image          `bson:"images"`
+	}
+	if err = cursor.All(ctx, &results); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting popular images"})
+		return
+	}
+
+	var total int64
+	var images []models.Image
+	if len(results) > 0 {
+		images = results[0].Images
+		if len(results[0].Total) > 0 {
+			total = results[0].Total[0].Count
+		}
+	}
+
+	respondImages(c, presignImages(ctx, os.Getenv("BUCKET_NAME"), images, 10*time.Minute), total, page, limit)
+}
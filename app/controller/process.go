@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/rwcarlsen/goexif/exif"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// paletteSize is how many dominant colors are kept per image.
+	paletteSize = 5
+	// lqipSize is the longest side in pixels of the inline placeholder.
+	lqipSize = 16
+	// maxUploadBytes is the largest file that can be uploaded.
+	maxUploadBytes = 20 << 20
+	// maxImagePixels is the largest image, in pixels, that is decoded. A
+	// small file can claim huge dimensions, and decoding allocates for all
+	// of them.
+	maxImagePixels = 50_000_000
+)
+
+// errImageTooLarge is returned by analyzeImage for images of more than
+// maxImagePixels pixels.
+var errImageTooLarge = errors.New("image has too many pixels")
+
+// analyzeImage decodes an uploaded image and fills in the metadata derived
+// from its pixels and EXIF tags. Files that are not a supported image format
+// are left untouched and the error is returned for logging. Images larger
+// than maxImagePixels are not decoded and errImageTooLarge is returned.
+func analyzeImage(data []byte, doc *models.Image) error {
+	readExif(data, doc)
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return fmt.Errorf("%w: %dx%d", errImageTooLarge, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	doc.Width, doc.Height = bounds.Dx(), bounds.Dy()
+	doc.Palette = utils.ExtractPalette(img, paletteSize)
+	doc.BlurHash = utils.BlurHash(img, 4, 3)
+
+	doc.LQIP, err = utils.LQIP(img, lqipSize)
+	return err
+}
+
+// readExif copies the GPS position and the time the photo was taken from the
+// EXIF tags, if there are any.
+func readExif(data []byte, doc *models.Image) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	if lat, lng, err := x.LatLong(); err == nil && lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 {
+		doc.Location = models.NewGeoPoint(lat, lng)
+	}
+	if takenAt, err := x.DateTime(); err == nil && !takenAt.IsZero() {
+		doc.TakenAt = &takenAt
+	}
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"ginmongo/models"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestAnalyzeImageRejectsTooManyPixels(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// Claim 50000x50000 pixels in the IHDR chunk, which follows the 8 byte
+	// signature, and fix up its CRC.
+	binary.BigEndian.PutUint32(data[16:20], 50000)
+	binary.BigEndian.PutUint32(data[20:24], 50000)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	var doc models.Image
+	if err := analyzeImage(data, &doc); !errors.Is(err, errImageTooLarge) {
+		t.Errorf("analyzeImage error = %v, want errImageTooLarge", err)
+	}
+}
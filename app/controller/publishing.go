@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// publishState returns the status and publish time an image ends up with when
+// status is requested with an optional publish_at. Asking to publish at a
+// future time schedules the image as a draft instead.
+func publishState(status, publishAt string) (string, *time.Time, error) {
+	var at *time.Time
+	if publishAt != "" {
+		parsed, err := time.Parse(time.RFC3339, publishAt)
+		if err != nil {
+			return "", nil, errors.New("publish_at must be an RFC 3339 time")
+		}
+		if parsed.After(time.Now()) {
+			at = &parsed
+		}
+	}
+	if status == models.ImagePublished && at != nil {
+		return models.ImageDraft, at, nil
+	}
+	return status, at, nil
+}
+
+// uploadStatus reads the status and publish_at form fields of an upload.
+// Uploads of callers allowed to publish go live right away by default and
+// everyone else's wait for review.
+func uploadStatus(c *gin.Context) (string, *time.Time, error) {
+	status := c.PostForm("status")
+	switch {
+	case status == "" && hasPermission(c, models.PermImagePublish):
+		status = models.ImagePublished
+	case status == "":
+		status = models.ImagePendingReview
+	case status == models.ImageDraft || status == models.ImagePendingReview:
+	case status == models.ImagePublished && hasPermission(c, models.PermImagePublish):
+	default:
+		return "", nil, errors.New("status must be draft or pending_review")
+	}
+	// A scheduled draft is published without review.
+	if status == models.ImageDraft && c.PostForm("publish_at") != "" && !hasPermission(c, models.PermImagePublish) {
+		return "", nil, errors.New("publish_at needs status pending_review")
+	}
+	return publishState(status, c.PostForm("publish_at"))
+}
+
+// InitPublishScheduler starts publishing scheduled drafts once their
+// publish_at has passed, checking every PUBLISH_INTERVAL_SECONDS (60 by
+// default).
+func InitPublishScheduler() {
+	interval := 60 * time.Second
+	if seconds, err := strconv.Atoi(os.Getenv("PUBLISH_INTERVAL_SECONDS")); err == nil && seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := publishDueImages(); err != nil {
+				log.Println("Error publishing scheduled images:", err)
+			}
+		}
+	}()
+}
+
+func publishDueImages() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := database.Client.Database("imagestore").Collection("images").UpdateMany(ctx,
+		bson.M{"status": models.ImageDraft, "publish_at": bson.M{"$lte": time.Now()}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"status": models.ImagePublished, "published_at": "$publish_at"}}},
+			{{Key: "$unset", Value: "publish_at"}},
+		})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount > 0 {
+		log.Println("Published", result.ModifiedCount, "scheduled images")
+	}
+	return nil
+}
+
+// statusUpdate is the body of SetImageStatus and ReviewImage.
+type statusUpdate struct {
+	Status    string `json:"status"`
+	Decision  string `json:"decision"` // approve or reject, for reviews
+	Note      string `json:"note"`
+	PublishAt string `json:"publish_at"`
+}
+
+// setStatus moves the image matching filter to status, returning the updated
+// image or mongo.ErrNoDocuments when nothing matched.
+func setStatus(ctx context.Context, filter bson.M, status string, publishAt *time.Time, note string) (models.Image, error) {
+	set := bson.M{"status": status}
+	unset := bson.M{}
+	if publishAt != nil {
+		set["publish_at"] = *publishAt
+	} else {
+		unset["publish_at"] = ""
+	}
+	if status == models.ImagePublished {
+		set["published_at"] = time.Now()
+	}
+	if note != "" {
+		set["review_note"] = note
+	} else {
+		unset["review_note"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var image models.Image
+	err := database.Client.Database("imagestore").Collection("images").FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&image)
+	return image, err
+}
+
+// SetImageStatus lets reviewers draft, schedule, publish or archive an image.
+func SetImageStatus(c *gin.Context) {
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var body statusUpdate
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	switch body.Status {
+	case models.ImageDraft, models.ImagePendingReview, models.ImagePublished, models.ImageArchived:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be draft, pending_review, published or archived"})
+		return
+	}
+	status, publishAt, err := publishState(body.Status, body.PublishAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image, err := setStatus(ctx, bson.M{"_id": imageID}, status, publishAt, "")
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Image not found"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
+
+// GetReviewQueue lists the images waiting for review, oldest first.
+func GetReviewQueue(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.Client.Database("imagestore").Collection("images")
+	filter := excludeHidden(bson.M{"status": models.ImagePendingReview})
+	page, limit, skip := paginationParams(c)
+
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploaded_at", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+
+	respondImages(c, presignImages(ctx, os.Getenv("BUCKET_NAME"), images, 10*time.Minute), total, page, limit)
+}
+
+// ReviewImage approves or rejects a pending upload. Approved images are
+// published, or scheduled when publish_at is in the future; rejected ones go
+// back to draft with the note for the uploader.
+func ReviewImage(c *gin.Context) {
+	imageID, err := bson.ObjectIDFromHex(c.Param("image_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var body statusUpdate
+	if err := c.ShouldBind(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	body.Note = strings.TrimSpace(body.Note)
+
+	var status string
+	var publishAt *time.Time
+	switch body.Decision {
+	case "approve":
+		// Keep the time the uploader asked for unless the reviewer sets one.
+		if body.PublishAt == "" {
+			var pending models.Image
+			err := database.Client.Database("imagestore").Collection("images").FindOne(ctx, bson.M{"_id": imageID},
+				options.FindOne().SetProjection(bson.M{"publish_at": 1})).Decode(&pending)
+			if err != nil && err != mongo.ErrNoDocuments {
+				log.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting image"})
+				return
+			}
+			if pending.PublishAt != nil {
+				body.PublishAt = pending.PublishAt.Format(time.RFC3339)
+			}
+		}
+		status, publishAt, err = publishState(models.ImagePublished, body.PublishAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		body.Note = ""
+	case "reject":
+		if body.Note == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "note is required when rejecting"})
+			return
+		}
+		status = models.ImageDraft
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decision must be approve or reject"})
+		return
+	}
+
+	// Only pending images can be reviewed, so two admins can't both decide.
+	image, err := setStatus(ctx, bson.M{"_id": imageID, "status": models.ImagePendingReview}, status, publishAt, body.Note)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusConflict, gin.H{"error": "Image is not pending review"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating image"})
+		return
+	}
+
+	c.JSON(http.StatusOK, image)
+}
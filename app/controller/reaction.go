@@ -0,0 +1,218 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// reactionCounters is the image field kept in step with each reaction kind.
+var reactionCounters = map[string]string{
+	models.ReactionLike:     "like_count",
+	models.ReactionFavorite: "favorite_count",
+}
+
+// imageIDParam reads the image id of routes under /images/:category/...
+// gin needs every wildcard in the same position to share a name, so image
+// routes reuse the :category of the category listing.
+func imageIDParam(c *gin.Context) (bson.ObjectID, bool) {
+	imageID, err := bson.ObjectIDFromHex(c.Param("category"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image id"})
+		return bson.NilObjectID, false
+	}
+	return imageID, true
+}
+
+// setReaction adds or removes the caller's reaction of the given kind. The
+// counter on the image only moves when the reaction document was actually
+// inserted or deleted, so repeated or concurrent toggles can't skew it.
+func setReaction(c *gin.Context, kind string, on bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	imageID, ok := imageIDParam(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := database.Client.Database("imagestore")
+	images := db.Collection("images")
+	reactions := db.Collection("reactions")
+
+	if _, ok := visibleImage(ctx, c, imageID); !ok {
+		return
+	}
+
+	var delta int
+	if on {
+		_, err := reactions.InsertOne(ctx, models.Reaction{
+			UserID:    userID,
+			ImageID:   imageID,
+			Kind:      kind,
+			CreatedAt: time.Now(),
+		})
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving " + kind})
+			return
+		}
+		if err == nil {
+			delta = 1
+		}
+	} else {
+		result, err := reactions.DeleteOne(ctx, bson.M{"user_id": userID, "image_id": imageID, "kind": kind})
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing " + kind})
+			return
+		}
+		delta = -int(result.DeletedCount)
+	}
+
+	counter := reactionCounters[kind]
+	var image models.Image
+	err := images.FindOneAndUpdate(ctx,
+		bson.M{"_id": imageID},
+		bson.M{"$inc": bson.M{counter: delta}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{counter: 1}),
+	).Decode(&image)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating " + counter})
+		return
+	}
+
+	count := image.LikeCount
+	if kind == models.ReactionFavorite {
+		count = image.FavoriteCount
+	}
+	c.JSON(http.StatusOK, gin.H{"image_id": imageID, kind: on, counter: count})
+}
+
+func LikeImage(c *gin.Context)       { setReaction(c, models.ReactionLike, true) }
+func UnlikeImage(c *gin.Context)     { setReaction(c, models.ReactionLike, false) }
+func FavoriteImage(c *gin.Context)   { setReaction(c, models.ReactionFavorite, true) }
+func UnfavoriteImage(c *gin.Context) { setReaction(c, models.ReactionFavorite, false) }
+
+// markReactions sets LikedByMe and FavoritedByMe on images for the caller.
+func markReactions(c *gin.Context, images []ImageResponse) {
+	userID := principal(c).UserID
+	if userID == "" || len(images) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ids := make([]bson.ObjectID, 0, len(images))
+	for _, img := range images {
+		ids = append(ids, img.ID)
+	}
+
+	cursor, err := database.Client.Database("imagestore").Collection("reactions").Find(ctx,
+		bson.M{"user_id": userID, "image_id": bson.M{"$in": ids}})
+	if err != nil {
+		log.Println("Error getting reactions:", err)
+		return
+	}
+	var reactions []models.Reaction
+	if err = cursor.All(ctx, &reactions); err != nil {
+		log.Println("Error getting reactions:", err)
+		return
+	}
+
+	liked := make(map[bson.ObjectID]bool)
+	favorited := make(map[bson.ObjectID]bool)
+	for _, reaction := range reactions {
+		if reaction.Kind == models.ReactionLike {
+			liked[reaction.ImageID] = true
+		} else {
+			favorited[reaction.ImageID] = true
+		}
+	}
+	for i := range images {
+		images[i].LikedByMe = liked[images[i].ID]
+		images[i].FavoritedByMe = favorited[images[i].ID]
+	}
+}
+
+// GetMyFavorites lists the caller's favorite images, most recently added first.
+func GetMyFavorites(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := database.Client.Database("imagestore")
+	filter := bson.M{"user_id": userID, "kind": models.ReactionFavorite}
+	page, limit, skip := paginationParams(c)
+
+	total, err := db.Collection("reactions").CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := db.Collection("reactions").Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting favorites"})
+		return
+	}
+	var favorites []models.Reaction
+	if err = cursor.All(ctx, &favorites); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting favorites"})
+		return
+	}
+
+	ids := make([]bson.ObjectID, 0, len(favorites))
+	for _, favorite := range favorites {
+		ids = append(ids, favorite.ImageID)
+	}
+	var found []models.Image
+	if len(ids) > 0 {
+		filter := publishedOnly(bson.M{"_id": bson.M{"$in": ids}})
+		if !readableOnly(ctx, c, filter) {
+			return
+		}
+		imageCursor, err := db.Collection("images").Find(ctx, filter)
+		if err == nil {
+			err = imageCursor.All(ctx, &found)
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+			return
+		}
+	}
+
+	byID := make(map[bson.ObjectID]models.Image, len(found))
+	for _, img := range found {
+		byID[img.ID] = img
+	}
+	images := make([]models.Image, 0, len(ids))
+	for _, id := range ids {
+		if img, ok := byID[id]; ok {
+			images = append(images, img)
+		}
+	}
+
+	respondImages(c, presignImages(ctx, os.Getenv("BUCKET_NAME"), images, 10*time.Minute), total, page, limit)
+}
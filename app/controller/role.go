@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/middlewares"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// defaultRole returns the role given to new registrations.
+func defaultRole(ctx context.Context) string {
+	var role models.Role
+	err := database.Client.Database("imagestore").Collection("roles").FindOne(ctx, bson.M{"default": true}).Decode(&role)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("Error getting default role:", err)
+		}
+		return models.RoleUser
+	}
+	return role.Name
+}
+
+// GetRoles lists the roles and every known permission.
+func GetRoles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.Client.Database("imagestore").Collection("roles").Find(ctx, bson.M{},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles"})
+		return
+	}
+	roles := []models.Role{}
+	if err = cursor.All(ctx, &roles); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "permissions": models.AllPermissions})
+}
+
+// PutRole creates a role or replaces its permissions. Making a role the
+// default takes the flag from the previous default role.
+func PutRole(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var role models.Role
+	if err := c.ShouldBind(&role); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	role.Name = c.Param("name")
+	if role.Name == models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The admin role always has every permission"})
+		return
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+	for _, permission := range role.Permissions {
+		if !slices.Contains(models.AllPermissions, permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission " + permission})
+			return
+		}
+	}
+	role.UpdatedAt = time.Now()
+
+	roles := database.Client.Database("imagestore").Collection("roles")
+	var current models.Role
+	err := roles.FindOne(ctx, bson.M{"_id": role.Name}).Decode(&current)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting role"})
+		return
+	}
+	if current.Default && !role.Default {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Make another role the default first"})
+		return
+	}
+	if role.Default && !current.Default {
+		_, err = roles.UpdateMany(ctx, bson.M{"default": true}, bson.M{"$set": bson.M{"default": false}})
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating roles"})
+			return
+		}
+	}
+
+	_, err = roles.ReplaceOne(ctx, bson.M{"_id": role.Name}, role, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving role"})
+		return
+	}
+	middlewares.InvalidateRoles()
+
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole removes a role no user holds any more.
+func DeleteRole(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	name := c.Param("name")
+	if name == models.RoleAdmin || name == models.RoleUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles can't be deleted"})
+		return
+	}
+
+	db := database.Client.Database("imagestore")
+	holders, err := db.Collection("users").CountDocuments(ctx, bson.M{"role": name})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting users"})
+		return
+	}
+	if holders > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role is still held by users", "users": holders})
+		return
+	}
+
+	result, err := db.Collection("roles").DeleteOne(ctx, bson.M{"_id": name, "default": bson.M{"$ne": true}})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting role"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found or is the default role"})
+		return
+	}
+	middlewares.InvalidateRoles()
+
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// suggestBudget is how long a type-ahead request may spend querying Mongo.
+// Whatever has not come back by then is left out and the response is marked
+// partial. Override with SUGGEST_BUDGET_MS.
+func suggestBudget() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("SUGGEST_BUDGET_MS")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return 150 * time.Millisecond
+}
+
+type suggestion struct {
+	kind   string
+	values []string
+	err    error
+}
+
+func SearchSuggest(c *gin.Context) {
+	prefix := strings.ToLower(strings.TrimSpace(c.Query("prefix")))
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing 'prefix' query parameter"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if limit < 1 || limit > 20 {
+		limit = 5
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), suggestBudget())
+	defer cancel()
+
+	db := database.Client.Database("imagestore")
+	quoted := regexp.QuoteMeta(prefix)
+	readable, err := readableCategories(ctx, c)
+	if err != nil {
+		log.Println("Error getting category access:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting categories"})
+		return
+	}
+	// Words of the prefix can be apart by any separator: "dr. st" suggests
+	// "Dr_Stone.png".
+	words := strings.Fields(utils.NormalizeQuery(prefix))
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	namePattern := "(^|[-_ .])" + strings.Join(words, "[-_ .]+")
+	nameFilter := inCategories(publishedOnly(bson.M{"file_name": bson.M{"$regex": namePattern, "$options": "i"}}), "category", readable)
+	tagFilter := inCategories(publishedOnly(bson.M{"tags": bson.M{"$regex": "^" + quoted}}), "category", readable)
+	categoryFilter := inCategories(bson.M{"category": bson.M{"$regex": "^" + quoted, "$options": "i"}}, "slug", readable)
+	results := make(chan suggestion, 3)
+
+	// File names match at the start of any word: "nar" suggests "Boruto_naruto.jpg".
+	go func() {
+		if len(words) == 0 {
+			results <- suggestion{kind: "names", values: []string{}}
+			return
+		}
+		var images []struct {
+			FileName string `bson:"file_name"`
+		}
+		cursor, err := db.Collection("images").Find(ctx, nameFilter,
+			options.Find().SetProjection(bson.M{"file_name": 1}).SetLimit(int64(limit)))
+		if err == nil {
+			err = cursor.All(ctx, &images)
+		}
+		names := make([]string, 0, len(images))
+		for _, img := range images {
+			names = append(names, img.FileName)
+		}
+		results <- suggestion{kind: "names", values: names, err: err}
+	}()
+
+	go func() {
+		// Distinct returns every tag of the matching images, not only the
+		// ones starting with prefix.
+		var distinct, tags []string
+		err := db.Collection("images").Distinct(ctx, "tags", tagFilter).Decode(&distinct)
+		sort.Strings(distinct)
+		for _, tag := range distinct {
+			if strings.HasPrefix(tag, prefix) && len(tags) < limit {
+				tags = append(tags, tag)
+			}
+		}
+		results <- suggestion{kind: "tags", values: tags, err: err}
+	}()
+
+	go func() {
+		var categories []struct {
+			Category string `bson:"category"`
+		}
+		cursor, err := db.Collection("categories").Find(ctx, categoryFilter,
+			options.Find().SetProjection(bson.M{"category": 1}).SetLimit(int64(limit)))
+		if err == nil {
+			err = cursor.All(ctx, &categories)
+		}
+		names := make([]string, 0, len(categories))
+		for _, category := range categories {
+			names = append(names, category.Category)
+		}
+		results <- suggestion{kind: "categories", values: names, err: err}
+	}()
+
+	response := gin.H{
+		"prefix":     prefix,
+		"names":      []string{},
+		"tags":       []string{},
+		"categories": []string{},
+		"partial":    false,
+	}
+	for range 3 {
+		select {
+		case result := <-results:
+			if result.err != nil {
+				log.Println("Suggest", result.kind, "error:", result.err)
+				response["partial"] = true
+				continue
+			}
+			if result.values != nil {
+				response[result.kind] = result.values
+			}
+		case <-ctx.Done():
+			response["partial"] = true
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
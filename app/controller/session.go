@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// createSession records a new login of userID from the requesting device.
+func createSession(ctx context.Context, c *gin.Context, userID string) (string, error) {
+	now := time.Now()
+	session := models.Session{
+		ID:         bson.NewObjectID().Hex(),
+		UserID:     userID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(utils.RefreshTokenTTL()),
+	}
+	_, err := database.Client.Database("imagestore").Collection("sessions").InsertOne(ctx, session)
+	return session.ID, err
+}
+
+// revokeSessions revokes the active sessions matching filter along with
+// their refresh tokens, returning how many were revoked. Access tokens of the
+// sessions are rejected by the JWT middleware from then on.
+func revokeSessions(ctx context.Context, filter bson.M) (int64, error) {
+	db := database.Client.Database("imagestore")
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	cursor, err := db.Collection("sessions").Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var sessions []models.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+
+	now := time.Now()
+	result, err := db.Collection("sessions").UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return 0, err
+	}
+	_, err = db.Collection("refresh_tokens").UpdateMany(ctx,
+		bson.M{"family_id": bson.M{"$in": ids}, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}})
+	return result.ModifiedCount, err
+}
+
+// GetSessions lists the caller's active sessions, most recently used first.
+func GetSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := database.Client.Database("imagestore").Collection("sessions").Find(ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting sessions"})
+		return
+	}
+	sessions := []models.Session{}
+	if err = cursor.All(ctx, &sessions); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting sessions"})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal(c).SessionID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession logs one of the caller's devices out.
+func RevokeSession(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := revokeSessions(ctx, bson.M{"_id": c.Param("id"), "user_id": userID})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if c.Param("id") == principal(c).SessionID {
+		setTokenCookie(c, "Bearer", "", 0)
+		setTokenCookie(c, "Refresh", "", 0)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": true})
+}
+
+// RevokeAllSessions logs the caller out everywhere, this device included.
+func RevokeAllSessions(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	revoked, err := revokeSessions(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+	setTokenCookie(c, "Bearer", "", 0)
+	setTokenCookie(c, "Refresh", "", 0)
+
+	c.JSON(http.StatusOK, gin.H{"status": true, "revoked": revoked})
+}
@@ -1,16 +1,21 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"ginmongo/database"
 	"ginmongo/models"
 	"ginmongo/utils"
+	"io"
 	"log"
+	"maps"
 	"math"
 	"net/http"
 	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,16 +25,39 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 type ImageResponse struct {
-	Category   string    `json:"category"`
-	FileName   string    `json:"file_name"`
-	S3Key      string    `json:"s3_key"`
-	S3URL      string    `json:"s3_url"`
-	SignedURL  string    `json:"signed_url"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	ID            bson.ObjectID        `json:"id"`
+	Category      string               `json:"category"`
+	FileName      string               `json:"file_name"`
+	S3Key         string               `json:"s3_key"`
+	S3URL         string               `json:"s3_url"`
+	SignedURL     string               `json:"signed_url"`
+	Tags          []string             `json:"tags,omitempty"`
+	Palette       []models.ColorSwatch `json:"palette,omitempty"`
+	Width         int                  `json:"width,omitempty"`
+	Height        int                  `json:"height,omitempty"`
+	BlurHash      string               `json:"blurhash,omitempty"`
+	LQIP          string               `json:"lqip,omitempty"`
+	Location      *models.GeoPoint     `json:"location,omitempty"`
+	TakenAt       *time.Time           `json:"taken_at,omitempty"`
+	LikeCount     int64                `json:"like_count"`
+	FavoriteCount int64                `json:"favorite_count"`
+	ViewCount     int64                `json:"view_count"`
+	DownloadCount int64                `json:"download_count"`
+	CommentCount  int64                `json:"comment_count"`
+	UploadedBy    string               `json:"uploaded_by,omitempty"`
+	Hidden        bool                 `json:"hidden,omitempty"`
+	ReviewNote    string               `json:"review_note,omitempty"`
+	Status        string               `json:"status"`
+	PublishAt     *time.Time           `json:"publish_at,omitempty"`
+	PublishedAt   *time.Time           `json:"published_at,omitempty"`
+	LikedByMe     bool                 `json:"liked_by_me"`
+	FavoritedByMe bool                 `json:"favorited_by_me"`
+	UploadedAt    time.Time            `json:"uploaded_at"`
 }
 
 var s3Client *s3.Client
@@ -46,27 +74,169 @@ func InitS3Client() {
 	presignClient = s3.NewPresignClient(s3Client)
 }
 
-func UploadImage(c *gin.Context) {
+// paginationParams reads the page and limit query parameters, defaulting to
+// the first page of 6 images.
+func paginationParams(c *gin.Context) (page, limit, skip int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ = strconv.Atoi(c.DefaultQuery("limit", "6"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 6
+	}
+	return page, limit, (page - 1) * limit
+}
+
+// presignImages builds the response for each image with a pre-signed GET URL
+// valid for expires. The public S3 URL is used when signing fails.
+func presignImages(ctx context.Context, bucketName string, images []models.Image, expires time.Duration) []ImageResponse {
+	responseImages := make([]ImageResponse, 0, len(images))
+	for _, img := range images {
+		request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucketName),
+			Key:    aws.String(img.S3Key),
+		}, func(opts *s3.PresignOptions) {
+			opts.Expires = expires
+		})
 
-	userRole, exists := c.Get("role")
-	log.Println(userRole.(string))
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "user role not found"})
+		signedURL := img.S3URL
+		if err == nil {
+			signedURL = request.URL
+		} else {
+			log.Println("Error generating pre-signed URL:", err)
+		}
+
+		responseImages = append(responseImages, ImageResponse{
+			ID:            img.ID,
+			Category:      img.Category,
+			FileName:      img.FileName,
+			S3Key:         img.S3Key,
+			S3URL:         img.S3URL,
+			SignedURL:     signedURL,
+			Tags:          img.Tags,
+			Palette:       img.Palette,
+			Width:         img.Width,
+			Height:        img.Height,
+			BlurHash:      img.BlurHash,
+			LQIP:          img.LQIP,
+			Location:      img.Location,
+			TakenAt:       img.TakenAt,
+			LikeCount:     img.LikeCount,
+			FavoriteCount: img.FavoriteCount,
+			ViewCount:     img.ViewCount,
+			DownloadCount: img.DownloadCount,
+			CommentCount:  img.CommentCount,
+			UploadedBy:    img.UploadedBy,
+			Hidden:        img.Hidden,
+			ReviewNote:    img.ReviewNote,
+			Status:        img.Status,
+			PublishAt:     img.PublishAt,
+			PublishedAt:   img.PublishedAt,
+			UploadedAt:    img.UploadedAt,
+		})
+	}
+	return responseImages
+}
+
+// respondImages writes one page of a listing. With format=geojson the located
+// images are returned as a GeoJSON FeatureCollection for map views. Fields of
+// extra are added to the response.
+func respondImages(c *gin.Context, images []ImageResponse, total int64, page, limit int, extra ...gin.H) {
+	markReactions(c, images)
+	hideLocations(c, images)
+	body := gin.H{
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
+	}
+	for _, fields := range extra {
+		maps.Copy(body, fields)
+	}
+
+	if c.Query("format") == "geojson" {
+		features := make([]gin.H, 0, len(images))
+		for _, img := range images {
+			if img.Location == nil {
+				continue
+			}
+			features = append(features, gin.H{
+				"type":       "Feature",
+				"geometry":   img.Location,
+				"properties": img,
+			})
+		}
+		body["type"] = "FeatureCollection"
+		body["features"] = features
+		c.JSON(http.StatusOK, body)
 		return
 	}
 
-	ok, err := utils.Authroizeuser(userRole.(string), "admin")
+	body["images"] = images
+	c.JSON(http.StatusOK, body)
+}
 
-	if err != nil || !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User unauthorized"})
-		return
+// parseTags splits a comma separated tag list into trimmed, lower case,
+// unique tags.
+func parseTags(raw string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range strings.Split(raw, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
 	}
+	return tags
+}
+
+func UploadImage(c *gin.Context) {
+
 	bucketName := os.Getenv("BUCKET_NAME")
 	region := os.Getenv("AWS_REGION")
-	category := c.Param("category")
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Unknown categories are rejected unless the uploader explicitly asks for
+	// them to be created with ?create_category=true. Contributors without
+	// image:upload can only use the categories they contribute to.
+	createCategory, _ := strconv.ParseBool(c.Query("create_category"))
+	createCategory = createCategory && hasPermission(c, models.PermImageUpload)
+	uploadCategory, err := resolveCategory(ctx, c.Param("category"), createCategory)
+	if errors.Is(err, errUnknownCategory) {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Unknown category"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+		return
+	}
+	if !canUploadTo(c, *uploadCategory) {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "You can't upload to this category"})
+		return
+	}
+	category := uploadCategory.Slug
+
+	status, publishAt, err := uploadStatus(c)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Leaves room for the other form fields.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadBytes+1<<20)
 	file, err := c.FormFile("image")
 
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || (err == nil && file.Size > maxUploadBytes) {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large"})
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "No image file provided"})
@@ -82,29 +252,77 @@ func UploadImage(c *gin.Context) {
 
 	defer fileContent.Close()
 
-	s3Key := fmt.Sprintf("%s/%s", category, file.Filename)
-
-	_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Key:    &s3Key,
-		Bucket: &bucketName,
-		Body:   fileContent,
-	})
-
+	data, err := io.ReadAll(io.LimitReader(fileContent, maxUploadBytes+1))
 	if err != nil {
 		log.Println(err)
-		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error uploading images"})
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Something went wrong"})
+		return
+	}
+	if len(data) > maxUploadBytes {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image is too large"})
 		return
 	}
 
+	// Keys don't use the category, whose slug can change and be taken by a
+	// new category, so an upload can never overwrite another image's file.
+	imageID := bson.NewObjectID()
+	s3Key := fmt.Sprintf("images/%s/%s", imageID.Hex(), file.Filename)
 	s3Url := fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, region, s3Key)
 
 	ImageDoc := &models.Image{
+		ID:         imageID,
 		Category:   category,
 		FileName:   file.Filename,
 		S3Key:      s3Key,
 		S3URL:      s3Url,
+		Tags:       parseTags(c.PostForm("tags")),
+		NameNgrams: utils.NameNgrams(file.Filename),
+		UploadedBy: principal(c).UserID,
+		Status:     status,
+		PublishAt:  publishAt,
 		UploadedAt: time.Now(),
 	}
+	if status == models.ImagePublished {
+		ImageDoc.PublishedAt = &ImageDoc.UploadedAt
+	}
+
+	if err := analyzeImage(data, ImageDoc); errors.Is(err, errImageTooLarge) {
+		c.IndentedJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Image dimensions are too large"})
+		return
+	} else if err != nil {
+		log.Println("Error analyzing image:", err)
+	}
+
+	// Drop the GPS position, both from our metadata and from the stored file,
+	// when the uploader or the deployment asks for it. Unless locations are
+	// shared, the file is stripped anyway: it is served to anyone who can see
+	// the image, while the location kept in Mongo is only shown to those
+	// allowed. Files it can't be removed from are refused rather than stored
+	// with it.
+	stripLocation, _ := strconv.ParseBool(c.PostForm("strip_location"))
+	stripLocation = stripLocation || os.Getenv("STRIP_LOCATION") == "true"
+	if stripLocation {
+		ImageDoc.Location = nil
+	}
+	if stripLocation || !geoSharing() {
+		data, err = utils.StripMetadata(data)
+		if err != nil {
+			c.IndentedJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Location can't be removed from this file format, upload a JPEG, PNG, WebP or GIF"})
+			return
+		}
+	}
+
+	_, err = s3Client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Key:    &s3Key,
+		Bucket: &bucketName,
+		Body:   bytes.NewReader(data),
+	})
+
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error uploading images"})
+		return
+	}
 
 	collection := database.Client.Database("imagestore").Collection("images")
 
@@ -114,6 +332,12 @@ func UploadImage(c *gin.Context) {
 		log.Println("Mongo Insert :", err)
 		return
 	}
+
+	_, err = database.Client.Database("imagestore").Collection("categories").UpdateOne(ctx,
+		bson.M{"slug": category}, bson.M{"$set": bson.M{"updated_at": ImageDoc.UploadedAt}})
+	if err != nil {
+		log.Println("Error updating category:", err)
+	}
 	c.IndentedJSON(http.StatusOK, result)
 }
 
@@ -121,24 +345,28 @@ func GetImagesByCategory(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	category := c.Param("category")
 	bucketName := os.Getenv("BUCKET_NAME")
 
 	collection := database.Client.Database("imagestore").Collection("images")
 
-	// --- Pagination parameters ---
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "6"))
-	if page < 1 {
-		page = 1
-	}
-	if limit < 1 {
-		limit = 6
-	}
-	skip := (page - 1) * limit
+	page, limit, skip := paginationParams(c)
 
-	// Create filter for the category
+	// Create filter for the category, and with recursive=true for every
+	// category below it too
+	category, err := categoryMatch(ctx, c, c.Param("category"))
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+		return
+	}
 	filter := bson.M{"category": category}
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
 
 	// Count documents MATCHING THE FILTER (not all documents)
 	total, err := collection.CountDocuments(ctx, filter)
@@ -152,7 +380,7 @@ func GetImagesByCategory(c *gin.Context) {
 	findOptions := options.Find().
 		SetSkip(int64(skip)).
 		SetLimit(int64(limit)).
-		SetSort(bson.D{{Key: "uploadedAt", Value: -1}})
+		SetSort(bson.D{{Key: "uploaded_at", Value: -1}})
 
 	cursor, err := collection.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -169,41 +397,7 @@ func GetImagesByCategory(c *gin.Context) {
 		return
 	}
 
-	// Generate pre-signed URLs for each image
-	responseImages := make([]ImageResponse, 0, len(images))
-	for _, img := range images {
-		// Generate pre-signed URL valid for 10 minutes
-		request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(img.S3Key),
-		}, func(opts *s3.PresignOptions) {
-			opts.Expires = time.Duration(10 * time.Minute)
-		})
-
-		signedURL := img.S3URL
-		if err == nil {
-			signedURL = request.URL
-		} else {
-			log.Println("Error generating pre-signed URL:", err)
-		}
-
-		responseImages = append(responseImages, ImageResponse{
-			Category:   img.Category,
-			FileName:   img.FileName,
-			S3Key:      img.S3Key,
-			S3URL:      img.S3URL,
-			SignedURL:  signedURL,
-			UploadedAt: img.UploadedAt,
-		})
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"images":     responseImages,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
-	})
+	respondImages(c, presignImages(ctx, bucketName, images, 10*time.Minute), total, page, limit)
 }
 
 func GetAllImages(c *gin.Context) {
@@ -216,25 +410,24 @@ func GetAllImages(c *gin.Context) {
 	bucketName := os.Getenv("BUCKET_NAME")
 
 	collection := database.Client.Database("imagestore").Collection("images")
-	// --- Pagination parameters ---
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "6"))
-	if page < 1 {
-		page = 1
+	page, limit, skip := paginationParams(c)
+	filter := bson.M{}
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if limit < 1 {
-		limit = 6
+	if !readableOnly(ctx, c, filter) {
+		return
 	}
-	skip := (page - 1) * limit
-	total, err := collection.CountDocuments(ctx, bson.M{})
+	total, err := collection.CountDocuments(ctx, filter)
 	if err != nil {
 		log.Println("Error counting documents:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploadedAt", Value: -1}})
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploaded_at", Value: -1}})
 
-	curson, err := collection.Find(ctx, bson.M{}, findOptions)
+	curson, err := collection.Find(ctx, filter, findOptions)
 
 	defer curson.Close(ctx)
 
@@ -243,48 +436,57 @@ func GetAllImages(c *gin.Context) {
 		return
 	}
 
-	var responseImages []ImageResponse
-	for _, img := range images {
-		// Generate pre-signed URL valid for 1 hour
-		request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(img.S3Key),
-		}, func(opts *s3.PresignOptions) {
-			opts.Expires = time.Duration(60 * time.Minute)
-		})
+	respondImages(c, presignImages(ctx, bucketName, images, 60*time.Minute), total, page, limit)
+}
 
-		signedURL := img.S3URL
-		if err == nil {
-			signedURL = request.URL
-		} else {
-			log.Println("Error generating pre-signed URL:", err)
-		}
+// GetMyUploads lists the caller's own uploads in every status, newest first,
+// optionally only those with the given status.
+func GetMyUploads(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-		responseImages = append(responseImages, ImageResponse{
-			Category:   img.Category,
-			FileName:   img.FileName,
-			S3Key:      img.S3Key,
-			S3URL:      img.S3URL,
-			SignedURL:  signedURL,
-			UploadedAt: img.UploadedAt,
-		})
+	collection := database.Client.Database("imagestore").Collection("images")
+	page, limit, skip := paginationParams(c)
+	filter := bson.M{"uploaded_by": userID}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
 	}
 
-	//
-	c.JSON(http.StatusOK, gin.H{
-		"images":     responseImages,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
-	})
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println("Error counting documents:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploaded_at", Value: -1}})
+	cursor, err := collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+	var images []models.Image
+	if err = cursor.All(ctx, &images); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting images"})
+		return
+	}
+
+	respondImages(c, presignImages(ctx, os.Getenv("BUCKET_NAME"), images, 10*time.Minute), total, page, limit)
 }
 
+// maxSearchCandidates caps how many documents a fuzzy search scores in memory.
+const maxSearchCandidates = 500
+
 func GetImagesByName(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	name := c.Query("name")
+	name := strings.TrimSpace(c.Query("name"))
 
 	log.Println(name)
 	bucketName := os.Getenv("BUCKET_NAME")
@@ -294,152 +496,89 @@ func GetImagesByName(c *gin.Context) {
 		return
 	}
 
-	collection := database.Client.Database("imagestore").Collection("images")
-	// --- Pagination parameters ---
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "6"))
-	if page < 1 {
-		page = 1
+	ngrams := utils.QueryNgrams(name)
+	if len(ngrams) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search term must contain letters or digits"})
+		return
 	}
-	if limit < 1 {
-		limit = 6
+
+	collection := database.Client.Database("imagestore").Collection("images")
+	page, limit, skip := paginationParams(c)
+
+	// Candidates either match the old separator tolerant regex
+	// ("god war" -> ".*god[-_ ]*war.*") or share a trigram with the search
+	// term. The ones sharing the most trigrams are then scored by edit
+	// distance, so "narto" still finds "naruto".
+	words := strings.Fields(utils.NormalizeQuery(name))
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
 	}
-	skip := (page - 1) * limit
-	// Case-insensitive regex search
-	// Build regex: "god war" -> ".*god[-_ ]*war.*"
-	pattern := strings.TrimSpace(name)
-	pattern = regexp.MustCompile(`\s+`).ReplaceAllString(pattern, "[-_ ]*")
-	pattern = fmt.Sprintf(".*%s.*", pattern)
+	pattern := fmt.Sprintf(".*%s.*", strings.Join(words, "[-_ .]*"))
 	filter := bson.M{
-		"file_name": bson.M{
-			"$regex":   pattern,
-			"$options": "i", // case-insensitive
+		"$or": bson.A{
+			bson.M{"file_name": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"name_ngrams": bson.M{"$in": ngrams}},
 		},
 	}
-	total, err := collection.CountDocuments(ctx, filter)
-	if err != nil {
-		log.Println("Error counting documents:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !readableOnly(ctx, c, filter) {
 		return
 	}
-	findOptions := options.Find().SetSkip(int64(skip)).SetLimit(int64(limit)).SetSort(bson.D{{Key: "uploadedAt", Value: -1}})
 
-	//opts := options.Find().SetSort(bson.D{{Key: "uploaded_at", Value: -1}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"overlap": bson.M{"$size": bson.M{
+			"$setIntersection": bson.A{bson.M{"$ifNull": bson.A{"$name_ngrams", bson.A{}}}, ngrams},
+		}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "overlap", Value: -1}, {Key: "uploaded_at", Value: -1}}}},
+		// One more than scored, to tell whether there were more.
+		{{Key: "$limit", Value: maxSearchCandidates + 1}},
+	}
 
-	cursor, err := collection.Find(ctx, filter, findOptions)
+	cursor, err := collection.Aggregate(ctx, pipeline)
 	if err != nil {
-		log.Println("Mongo find error:", err)
+		log.Println("Mongo aggregate error:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching images"})
 		return
 	}
 	defer cursor.Close(ctx)
 
-	var images []models.Image
-	if err = cursor.All(ctx, &images); err != nil {
+	var candidates []models.Image
+	if err = cursor.All(ctx, &candidates); err != nil {
 		log.Println("Mongo cursor error:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing results"})
 		return
 	}
-
-	var responseImages []ImageResponse
-	for _, img := range images {
-		request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
-			Bucket: aws.String(bucketName),
-			Key:    aws.String(img.S3Key),
-		}, func(opts *s3.PresignOptions) {
-			opts.Expires = 10 * time.Minute
-		})
-
-		signedURL := img.S3URL
-		if err == nil {
-			signedURL = request.URL
-		} else {
-			log.Println("Error generating pre-signed URL:", err)
-		}
-
-		responseImages = append(responseImages, ImageResponse{
-			Category:   img.Category,
-			FileName:   img.FileName,
-			S3Key:      img.S3Key,
-			S3URL:      img.S3URL,
-			SignedURL:  signedURL,
-			UploadedAt: img.UploadedAt,
-		})
-	}
-
-	// c.JSON(http.StatusOK, gin.H{
-	// 	"search": name,
-	// 	"images": responseImages,
-	// 	"total":  len(responseImages),
-	// })
-	c.JSON(http.StatusOK, gin.H{
-		"images":     responseImages,
-		"total":      total,
-		"page":       page,
-		"limit":      limit,
-		"totalPages": int(math.Ceil(float64(total) / float64(limit))),
-	})
-}
-
-func CreateCategory(c *gin.Context) {
-	userRole, exists := c.Get("role")
-	log.Println(userRole.(string))
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
-		return
-	}
-
-	ok, err := utils.Authroizeuser(userRole.(string), "admin")
-
-	if err != nil || !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User role not found"})
-		return
+	// Only the best candidates are scored, so total can be short of the
+	// real number of matches. The response says so.
+	truncated := len(candidates) > maxSearchCandidates
+	if truncated {
+		candidates = candidates[:maxSearchCandidates]
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	var category models.Category
 
-	if err := c.ShouldBind(&category); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "INvalid payload"})
-		return
+	type scoredImage struct {
+		image models.Image
+		score float64
 	}
-
-	collection := database.Client.Database("imagestore").Collection("categories")
-
-	_, err = collection.InsertOne(ctx, bson.M{"category": category.Category})
-	if err != nil {
-		log.Println(err)
-		return
+	var matches []scoredImage
+	for _, img := range candidates {
+		if score, ok := utils.FuzzyScore(name, img.FileName); ok {
+			matches = append(matches, scoredImage{image: img, score: score})
+		}
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"status":   true,
-		"category": category.Category,
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
 	})
-}
-
-func GetCategories(c *gin.Context) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	var category []models.Category
 
-	collection := database.Client.Database("imagestore").Collection("categories")
-
-	total, err := collection.CountDocuments(ctx, bson.M{})
-	if err != nil {
-		log.Println("Error counting documents:", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-		return
-	}
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	if err = cursor.All(ctx, &category); err != nil {
-		log.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error parsing images"})
-		return
+	total := int64(len(matches))
+	images := make([]models.Image, 0, limit)
+	for i := skip; i < len(matches) && i < skip+limit; i++ {
+		images = append(images, matches[i].image)
 	}
-	c.JSON(http.StatusOK, gin.H{"Category": category, "total": total})
+
+	respondImages(c, presignImages(ctx, bucketName, images, 10*time.Minute), total, page, limit,
+		gin.H{"truncated": truncated})
 }
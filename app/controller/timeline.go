@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// timelineFormats maps each supported interval to the $dateToString format
+// used as its bucket key.
+var timelineFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"month": "%Y-%m",
+	"year":  "%Y",
+}
+
+type timelineBucket struct {
+	Period string `json:"period" bson:"_id"`
+	Count  int64  `json:"count" bson:"count"`
+}
+
+// GetTimeline counts images per day, month or year, oldest first. It takes the
+// same category (and recursive), from/to, date_field and color filters as the
+// listings, plus an optional tz (IANA name, default UTC) the buckets are cut
+// in.
+func GetTimeline(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	interval := c.DefaultQuery("interval", "month")
+	format, ok := timelineFormats[interval]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, month or year"})
+		return
+	}
+
+	timezone := c.DefaultQuery("tz", "UTC")
+	if _, err := time.LoadLocation(timezone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+
+	dateField, err := dateFieldParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter := bson.M{dateField: bson.M{"$ne": nil}}
+	if name := c.Query("category"); name != "" {
+		category, err := categoryMatch(ctx, c, name)
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting category"})
+			return
+		}
+		filter["category"] = category
+	}
+	if err := applyImageFilters(c, filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !readableOnly(ctx, c, filter) {
+		return
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateToString": bson.M{
+				"format":   format,
+				"date":     "$" + dateField,
+				"timezone": timezone,
+			}},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+
+	collection := database.Client.Database("imagestore").Collection("images")
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("Mongo aggregate error:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building timeline"})
+		return
+	}
+	defer cursor.Close(ctx)
+
+	buckets := []timelineBucket{}
+	if err = cursor.All(ctx, &buckets); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error building timeline"})
+		return
+	}
+
+	var total int64
+	for _, bucket := range buckets {
+		total += bucket.Count
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"interval":   interval,
+		"date_field": dateField,
+		"buckets":    buckets,
+		"total":      total,
+	})
+}
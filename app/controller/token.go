@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// tokenResponse is returned by Login and RefreshToken.
+type tokenResponse struct {
+	Status       string `json:"status"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until token expires
+}
+
+func setTokenCookie(c *gin.Context, name, value string, ttl time.Duration) {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  time.Now().Add(ttl),
+		Secure:   false,
+		HttpOnly: true,
+		//SameSite: http.SameSiteStrictMode,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if ttl <= 0 {
+		cookie.Expires = time.Now().Add(-1 * time.Second)
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+// issueTokens signs an access token for user's session and stores a new
+// refresh token of it, setting both as cookies for browsers.
+func issueTokens(ctx context.Context, c *gin.Context, user *models.User, sessionID string) (tokenResponse, error) {
+	token, err := utils.SignedToken(user.UserID, user.Email, user.FirstName, user.LastName, user.Role, sessionID, !user.EmailVerified)
+	if err != nil {
+		return tokenResponse{}, err
+	}
+	refreshToken, refreshHash, err := utils.NewRefreshToken()
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	now := time.Now()
+	_, err = database.Client.Database("imagestore").Collection("refresh_tokens").InsertOne(ctx, models.RefreshToken{
+		UserID:    user.UserID,
+		FamilyID:  sessionID,
+		TokenHash: refreshHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(utils.RefreshTokenTTL()),
+	})
+	if err != nil {
+		return tokenResponse{}, err
+	}
+
+	setTokenCookie(c, "Bearer", token, utils.AccessTokenTTL())
+	setTokenCookie(c, "Refresh", refreshToken, utils.RefreshTokenTTL())
+
+	return tokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
+}
+
+// refreshTokenParam reads the refresh token from the Refresh cookie or the
+// refresh_token of a JSON body.
+func refreshTokenParam(c *gin.Context) string {
+	if cookie, err := c.Request.Cookie("Refresh"); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	_ = c.ShouldBindJSON(&body)
+	return body.RefreshToken
+}
+
+// revokeAccessToken denylists the access token of the request until it
+// expires.
+func revokeAccessToken(ctx context.Context, c *gin.Context) error {
+	claims, err := utils.ParseToken(utils.BearerToken(c.Request))
+	if err != nil || claims.ID == "" {
+		// Invalid and expired tokens are rejected anyway.
+		return nil
+	}
+	_, err = database.Client.Database("imagestore").Collection("revoked_tokens").UpdateOne(ctx,
+		bson.M{"_id": claims.ID},
+		bson.M{"$set": models.RevokedToken{JTI: claims.ID, UserID: claims.UserID, ExpiresAt: claims.ExpiresAt.Time}},
+		options.UpdateOne().SetUpsert(true))
+	return err
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// Every refresh token works once: reusing one revokes its whole session, so
+// a stolen token stops working for both the thief and the user.
+func RefreshToken(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	presented := refreshTokenParam(c)
+	if presented == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token required"})
+		return
+	}
+
+	collection := database.Client.Database("imagestore").Collection("refresh_tokens")
+	var stored models.RefreshToken
+	err := collection.FindOne(ctx, bson.M{"token_hash": utils.HashRefreshToken(presented)}).Decode(&stored)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if stored.RevokedAt != nil || stored.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired"})
+		return
+	}
+
+	// Claim the token; failing to means it was already used.
+	err = collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": stored.ID, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": time.Now()}}).Err()
+	if err == mongo.ErrNoDocuments {
+		log.Println("Refresh token reuse detected for user", stored.UserID)
+		if _, err := revokeSessions(ctx, bson.M{"_id": stored.FamilyID}); err != nil {
+			log.Println("Error revoking session:", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	user := &models.User{}
+	err = database.Client.Database("imagestore").Collection("users").FindOne(ctx, bson.M{"user_id": stored.UserID}).Decode(user)
+	if err != nil || user.Disabled {
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Println(err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	// Refreshing keeps the session alive for another refresh token lifetime.
+	now := time.Now()
+	_, err = database.Client.Database("imagestore").Collection("sessions").UpdateOne(ctx,
+		bson.M{"_id": stored.FamilyID},
+		bson.M{"$set": bson.M{"last_seen_at": now, "expires_at": now.Add(utils.RefreshTokenTTL())}})
+	if err != nil {
+		log.Println("Error updating session:", err)
+	}
+
+	response, err := issueTokens(ctx, c, user, stored.FamilyID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing tokens"})
+		return
+	}
+	response.Status = "Token refreshed"
+	c.IndentedJSON(http.StatusOK, response)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
-	"crypto/tls"
 	"encoding/hex"
 	"fmt"
 	"ginmongo/database"
@@ -12,7 +11,6 @@ import (
 	"ginmongo/utils"
 	"log"
 	"net/http"
-	"net/smtp"
 	"os"
 	"strconv"
 	"time"
@@ -20,6 +18,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func RegisterUser(c *gin.Context) {
@@ -67,7 +66,8 @@ func RegisterUser(c *gin.Context) {
 	user.Password = HashPas
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
-	user.Role = "user"
+	user.Role = defaultRole(ctx)
+	user.EmailVerified = false
 
 	result, err := collection.InsertOne(ctx, user)
 	if err != nil {
@@ -76,6 +76,11 @@ func RegisterUser(c *gin.Context) {
 		return
 	}
 
+	// The user can ask for another link if this one doesn't arrive.
+	if err = sendVerificationEmail(ctx, &user, user.Email); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+
 	c.IndentedJSON(http.StatusOK, result)
 }
 
@@ -93,72 +98,101 @@ func Login(c *gin.Context) {
 	err = validate.Struct(userLogin)
 	if err != nil {
 		log.Println(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
 		return
 	}
-	if userLogin.Email == "" || userLogin.Password == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Both are required"})
-	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	collection := database.Client.Database("imagestore").Collection("users")
 
+	attempt, ok := loginAttempt(ctx, c, userLogin.Email)
+	if !ok {
+		return
+	}
+
 	userExist := &models.User{}
 
 	err = collection.FindOne(ctx, bson.M{"email": userLogin.Email}).Decode(userExist)
+	if err == mongo.ErrNoDocuments {
+		// Take as long as a wrong password would.
+		_ = utils.ComparePass(userLogin.Password, dummyHash())
+		loginFailed(ctx, c, attempt, userLogin.Email)
+		return
+	}
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 	err = utils.ComparePass(userLogin.Password, userExist.Password)
 	if err != nil {
-		log.Println(err)
+		loginFailed(ctx, c, attempt, userLogin.Email)
+		return
+	}
+	loginSucceeded(ctx, c, userLogin.Email)
+	if userExist.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
+	if !userExist.EmailVerified && unverifiedLoginBlocked() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before logging in"})
+		return
+	}
+	if userExist.PasswordResetRequired {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required, check your email for the reset link"})
 		return
 	}
 
-	token, err := utils.SignedToken(userLogin.Email, userExist.FirstName, userExist.LastName,
-		userExist.Role)
-
+	sessionID, err := createSession(ctx, c, userExist.UserID)
 	if err != nil {
 		log.Println(err)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating session"})
 		return
 	}
-
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "Bearer",
-		Value:    token,
-		Path:     "/",
-		Expires:  time.Now().Add(1 * time.Hour),
-		Secure:   false,
-		HttpOnly: true,
-		//SameSite: http.SameSiteStrictMode,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	response := struct {
-		Status string `json:"status"`
-		Token  string `json:"token"`
-	}{
-		Status: "Login Successfull",
-		Token:  token,
+	response, err := issueTokens(ctx, c, userExist, sessionID)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing tokens"})
+		return
 	}
+	response.Status = "Login Successfull"
 	c.IndentedJSON(http.StatusOK, response)
 }
 
+// Logout revokes the session, found from the refresh token or the access
+// token it was called with, denylists that access token and clears the
+// cookies.
 func Logout(c *gin.Context) {
-	http.SetCookie(c.Writer, &http.Cookie{
-		Name:     "Bearer",
-		Value:    "",
-		Path:     "/",
-		Expires:  time.Now().Add(-1 * time.Second),
-		MaxAge:   -1,
-		Secure:   false,
-		HttpOnly: true,
-		//SameSite: http.SameSiteStrictMode,
-		SameSite: http.SameSiteLaxMode,
-	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var sessionID string
+	if refreshToken := refreshTokenParam(c); refreshToken != "" {
+		var stored models.RefreshToken
+		err := database.Client.Database("imagestore").Collection("refresh_tokens").
+			FindOne(ctx, bson.M{"token_hash": utils.HashRefreshToken(refreshToken)}).Decode(&stored)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Println("Error getting refresh token:", err)
+		}
+		sessionID = stored.FamilyID
+	}
+	if sessionID == "" {
+		if claims, err := utils.ParseToken(utils.BearerToken(c.Request)); err == nil {
+			sessionID = claims.SessionID
+		}
+	}
+	if sessionID != "" {
+		if _, err := revokeSessions(ctx, bson.M{"_id": sessionID}); err != nil {
+			log.Println("Error revoking session:", err)
+		}
+	}
+	if err := revokeAccessToken(ctx, c); err != nil {
+		log.Println("Error revoking access token:", err)
+	}
+
+	setTokenCookie(c, "Bearer", "", 0)
+	setTokenCookie(c, "Refresh", "", 0)
 
 	response := struct {
 		Status string `json:"status"`
@@ -168,11 +202,16 @@ func Logout(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, response)
 }
 
+// UpdatePassword changes the caller's password, checking the current one.
+// The legacy POST /users/:user_id route only works on the caller's own
+// user_id. Other sessions are logged out.
 func UpdatePassword(c *gin.Context) {
-	userId := c.Param("user_id")
-
-	if userId == "" {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Id is missing"})
+	userId, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	if param := c.Param("user_id"); param != "" && param != userId {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"error": "You can only change your own password"})
 		return
 	}
 	var updatePass models.PasswordUpdate
@@ -204,21 +243,13 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
-	if updatePass.CurrentPassword == "" || user.Password == "" {
-		c.IndentedJSON(http.StatusOK, gin.H{"error": "Both are required"})
-		return
-	}
-	err = utils.ComparePass(updatePass.CurrentPassword, user.Password)
-
-	if err != nil {
-		log.Println(err)
-		c.IndentedJSON(http.StatusOK, gin.H{"error": "Incorrect Password"})
+	if !checkCurrentPassword(ctx, c, user, updatePass.CurrentPassword) {
 		return
 	}
 	newHashPass, err := utils.HashPass(updatePass.NewPassword)
 	if err != nil {
 		log.Println(err)
-		c.IndentedJSON(http.StatusOK, gin.H{"error": "Incorrect encrypting password"})
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Incorrect encrypting password"})
 		return
 	}
 
@@ -239,6 +270,12 @@ func UpdatePassword(c *gin.Context) {
 		return
 	}
 
+	// Whoever knew the old password is logged out, except this session.
+	_, err = revokeSessions(ctx, bson.M{"user_id": user.UserID, "_id": bson.M{"$ne": principal(c).SessionID}})
+	if err != nil {
+		log.Println("Error revoking sessions:", err)
+	}
+
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
@@ -278,104 +315,49 @@ func ForgetPassword(c *gin.Context) {
 		return
 	}
 
-	duration, err := strconv.Atoi(os.Getenv("RESET_TOKEN_EXPIRY"))
-	if err != nil {
+	if err = sendPasswordReset(ctx, user, false); err != nil {
 		log.Println(err)
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Error converting token expiry"})
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error sending mail"})
 		return
 	}
-	mins := time.Duration(duration)
-
-	expiry := time.Now().Add(mins * time.Minute)
+	c.IndentedJSON(http.StatusOK, gin.H{"message": "mail has been send"})
+}
 
-	tokenByte := make([]byte, 16)
-	_, err = rand.Read(tokenByte)
+// sendPasswordReset stores a new reset token for user, valid for
+// RESET_TOKEN_EXPIRY minutes, and emails them the link to use it. A forced
+// reset tells the user an admin asked for it.
+func sendPasswordReset(ctx context.Context, user *models.User, forced bool) error {
+	duration, err := strconv.Atoi(os.Getenv("RESET_TOKEN_EXPIRY"))
 	if err != nil {
-		log.Println(err)
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Error creating byte value"})
-		return
+		return fmt.Errorf("RESET_TOKEN_EXPIRY: %w", err)
 	}
+	expiry := time.Now().Add(time.Duration(duration) * time.Minute)
 
+	tokenByte := make([]byte, 16)
+	if _, err = rand.Read(tokenByte); err != nil {
+		return err
+	}
 	token := hex.EncodeToString(tokenByte)
 	hashedToken := sha256.Sum256(tokenByte)
 
-	hashTokenStr := hex.EncodeToString(hashedToken[:])
-
-	_, err = collection.UpdateOne(
+	_, err = database.Client.Database("imagestore").Collection("users").UpdateOne(
 		ctx,
-		bson.M{"email": req.Email},
+		bson.M{"user_id": user.UserID},
 		bson.M{"$set": bson.M{
-			"password_reset_token":   hashTokenStr,
+			"password_reset_token":   hex.EncodeToString(hashedToken[:]),
 			"password_token_expired": expiry,
 		}},
 	)
 	if err != nil {
-		log.Println(err)
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"error": "Error updating token"})
-		return
-	}
-	frontendUri := os.Getenv("FRONTEND_URI")
-	resetURL := fmt.Sprintf("%v/users/resetpassword/reset/%s", frontendUri, token)
-	message := fmt.Sprintf("Forgot your password ? Reset using the following link: \n%s\n If you didn't request the password reset ignore this message", resetURL)
-
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	smtpPass := os.Getenv("SMTP_PASSWORD")
-
-	smtpClient, err := smtp.Dial(smtpHost + ":" + smtpPort)
-
-	if err != nil {
-		log.Println(err)
-		return
+		return err
 	}
 
-	err = smtpClient.StartTLS(&tls.Config{ServerName: smtpHost})
-	if err != nil {
-		log.Println(err)
-		return
-	}
-
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-	if err = smtpClient.Auth(auth); err != nil {
-		log.Fatal(err)
-		return
-	}
-	// Set the sender and recipient first
-	if err := smtpClient.Mail(smtpUser); err != nil {
-		log.Fatal(err)
-		return
-	}
-	if err := smtpClient.Rcpt(req.Email); err != nil {
-		log.Fatal(err)
-		return
-	}
-
-	// Send the email body.
-	wc, err := smtpClient.Data()
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-	emailBody := fmt.Sprintf("To: %s\r\nSubject: Password Reset Request\r\n\r\n%s", req.Email, message)
-	_, err = fmt.Fprintf(wc, emailBody)
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-	err = wc.Close()
-	if err != nil {
-		log.Fatal(err)
-		return
-	}
-
-	// Send the QUIT command and close the connection.
-	err = smtpClient.Quit()
-	if err != nil {
-		log.Fatal(err)
-		return
+	resetURL := fmt.Sprintf("%v/users/resetpassword/reset/%s", os.Getenv("FRONTEND_URI"), token)
+	message := fmt.Sprintf("Forgot your password ? Reset using the following link: \n%s\n If you didn't request the password reset ignore this message", resetURL)
+	if forced {
+		message = fmt.Sprintf("An administrator has asked you to choose a new password before you log in again. Reset it using the following link: \n%s\n", resetURL)
 	}
-	c.IndentedJSON(http.StatusOK, gin.H{"message": "mail has been send"})
+	return utils.SendMail(user.Email, "Password Reset Request", message)
 }
 
 func ResetPassword(c *gin.Context) {
@@ -445,13 +427,25 @@ func ResetPassword(c *gin.Context) {
 	_, err = collection.UpdateOne(
 		ctx,
 		bson.M{"user_id": user.UserID},
-		bson.M{"$set": bson.M{
-			"password":               user.Password,
-			"password_reset_token":   "",
-			"password_token_expired": time.Time{},
-			"updated_at":             user.UpdatedAt,
-		}},
+		bson.M{
+			"$set": bson.M{
+				"password":               user.Password,
+				"password_reset_token":   "",
+				"password_token_expired": time.Time{},
+				"updated_at":             user.UpdatedAt,
+			},
+			"$unset": bson.M{"password_reset_required": ""},
+		},
 	)
+	if err != nil {
+		log.Println(err)
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+		return
+	}
+	// A new password also lifts a login lockout.
+	if err := clearFailures(ctx, accountKey(user.Email)); err != nil {
+		log.Println("Error clearing login failures:", err)
+	}
 
 	c.IndentedJSON(http.StatusOK, gin.H{"message": "Password Updated Successfully"})
 }
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"ginmongo/database"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// verificationResendInterval is how long a user has to wait between
+// verification emails, EMAIL_VERIFY_RESEND_SECONDS (60 by default).
+func verificationResendInterval() time.Duration {
+	if seconds, err := strconv.Atoi(os.Getenv("EMAIL_VERIFY_RESEND_SECONDS")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 60 * time.Second
+}
+
+// unverifiedLoginBlocked reports whether users must verify their email before
+// they can log in. With UNVERIFIED_LOGIN=read_only, the default, they can log
+// in but only read.
+func unverifiedLoginBlocked() bool {
+	return os.Getenv("UNVERIFIED_LOGIN") == "blocked"
+}
+
+// sendVerificationEmail emails a link verifying email, the address of user or
+// the one they are changing to, to that address.
+func sendVerificationEmail(ctx context.Context, user *models.User, email string) error {
+	_, err := database.Client.Database("imagestore").Collection("users").UpdateOne(ctx,
+		bson.M{"user_id": user.UserID}, bson.M{"$set": bson.M{"verification_sent_at": time.Now()}})
+	if err != nil {
+		return err
+	}
+	return mailVerificationLink(user, email)
+}
+
+// mailVerificationLink is sendVerificationEmail without recording when the
+// link was sent.
+func mailVerificationLink(user *models.User, email string) error {
+	token, err := utils.SignedVerificationToken(user.UserID, email)
+	if err != nil {
+		return err
+	}
+
+	verifyURL := fmt.Sprintf("%v/verify-email/%s", os.Getenv("FRONTEND_URI"), token)
+	message := fmt.Sprintf("Welcome! Confirm your email address using the following link: \n%s\n The link works for %v. If you didn't create an account ignore this message",
+		verifyURL, utils.EmailVerificationTTL())
+	return utils.SendMail(email, "Verify your email address", message)
+}
+
+// VerifyEmail marks the email address of a verification token as verified,
+// switching the user to it when it is the address they are changing to. The
+// new state shows up in access tokens issued from then on.
+func VerifyEmail(c *gin.Context) {
+	claims, err := utils.ParseVerificationToken(c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	collection := database.Client.Database("imagestore").Collection("users")
+	filter := bson.M{"user_id": claims.Subject, "email": claims.Email}
+	set := bson.M{"email_verified": true, "updated_at": time.Now()}
+	unset := bson.M{"verification_sent_at": ""}
+	pending, err := collection.CountDocuments(ctx, bson.M{"user_id": claims.Subject, "pending_email": claims.Email})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+		return
+	}
+	if pending > 0 {
+		// Someone may have registered the address since the change started.
+		taken, err := collection.CountDocuments(ctx, bson.M{"email": claims.Email})
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+			return
+		}
+		if taken > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+			return
+		}
+		filter = bson.M{"user_id": claims.Subject, "pending_email": claims.Email}
+		set["email"] = claims.Email
+		unset["pending_email"] = ""
+	}
+
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": set, "$unset": unset})
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification emails a new verification link, at most once every
+// verificationResendInterval per user. The answer is the same whether or not
+// the address belongs to an unverified account, and whether or not a link
+// was sent.
+func ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Request Body"})
+		return
+	}
+	if err := validator.New().Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation Failed", "details": err.Error()})
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sent := gin.H{"message": "If the account needs verifying, a new link has been sent"}
+
+	// Claiming the send slot and finding the user are one write, so parallel
+	// requests can't both send. Throttled and failed sends get the same
+	// answer as unknown addresses, or they would tell which have an account.
+	now := time.Now()
+	user := &models.User{}
+	err := database.Client.Database("imagestore").Collection("users").FindOneAndUpdate(ctx,
+		bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"email": req.Email, "email_verified": false},
+				bson.M{"pending_email": req.Email},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{"verification_sent_at": nil},
+				bson.M{"verification_sent_at": bson.M{"$lt": now.Add(-verificationResendInterval())}},
+			}},
+		}},
+		bson.M{"$set": bson.M{"verification_sent_at": now}}).Decode(user)
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusOK, sent)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	if err = mailVerificationLink(user, req.Email); err != nil {
+		log.Println("Error sending verification email:", err)
+	}
+	c.JSON(http.StatusOK, sent)
+}
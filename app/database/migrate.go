@@ -0,0 +1,359 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ginmongo/models"
+	"ginmongo/utils"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Migrate backfills fields added after images were first stored and makes
+// sure the indexes the handlers rely on exist. It is safe to run on every
+// start. Every step is run even when an earlier one fails, and the errors
+// are returned together.
+func Migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	steps := []struct {
+		name string
+		run  func(context.Context) error
+	}{
+		{"backfill name_ngrams", backfillNameNgrams},
+		{"backfill category slugs", backfillCategorySlugs},
+		{"backfill category paths", backfillCategoryPaths},
+		{"backfill image status", backfillImageStatus},
+		{"backfill email_verified", backfillEmailVerified},
+		{"seed roles", seedRoles},
+		{"create indexes", ensureIndexes},
+	}
+	var errs []error
+	for _, step := range steps {
+		if err := step.run(ctx); err != nil {
+			log.Println("Migration", step.name, "error:", err)
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ensureIndexes creates the indexes of each collection. A collection whose
+// indexes fail doesn't keep the others from getting theirs.
+func ensureIndexes(ctx context.Context) error {
+	db := Client.Database("imagestore")
+	var errs []error
+	create := func(collection string, indexes []mongo.IndexModel) {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			errs = append(errs, fmt.Errorf("%s indexes: %w", collection, err))
+		}
+	}
+
+	create("images", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name_ngrams", Value: 1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "location", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "uploaded_at", Value: -1}}},
+		{Keys: bson.D{{Key: "taken_at", Value: -1}}},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+	})
+
+	create("categories", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "path", Value: 1}}},
+		{Keys: bson.D{{Key: "parent", Value: 1}}},
+		// Display names are unique regardless of case.
+		{Keys: bson.D{{Key: "category", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetCollation(&options.Collation{Locale: "en", Strength: 2})},
+	})
+
+	create("albums", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "visibility", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "image_ids", Value: 1}}},
+	})
+
+	// One reaction of each kind per user and image.
+	create("reactions", []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "image_id", Value: 1}, {Key: "kind", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "image_id", Value: 1}}},
+	})
+
+	// Hourly rollups are only read for the last 30 days.
+	create("image_stats", []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "image_id", Value: 1}, {Key: "hour", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "hour", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(31 * 24 * 60 * 60)},
+	})
+
+	create("comments", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "image_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+
+	// One open report per user and image; resolved ones are kept for history.
+	create("reports", []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "image_id", Value: 1}, {Key: "reporter_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"status": "open"}),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+	})
+
+	create("moderation_audit", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "image_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+
+	create("images", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "uploaded_by", Value: 1}, {Key: "uploaded_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "uploaded_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "publish_at", Value: 1}}},
+	})
+
+	// Refresh tokens and denylisted access tokens are dropped once expired.
+	create("refresh_tokens", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	create("revoked_tokens", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	create("sessions", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	create("auth_failures", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+
+	// Users are looked up by user_id and listed newest first by admins.
+	create("users", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+	})
+	return errors.Join(errs...)
+}
+
+func backfillNameNgrams(ctx context.Context) error {
+	collection := Client.Database("imagestore").Collection("images")
+
+	cursor, err := collection.Find(ctx,
+		bson.M{"name_ngrams": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"file_name": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID       bson.ObjectID `bson:"_id"`
+			FileName string        `bson:"file_name"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		_, err := collection.UpdateByID(ctx, doc.ID, bson.M{"$set": bson.M{
+			"name_ngrams": utils.NameNgrams(doc.FileName),
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// legacyCategory is a category created before slugs existed.
+type legacyCategory struct {
+	ID       bson.ObjectID `bson:"_id"`
+	Category string        `bson:"category"`
+	// Set by planSlugs.
+	Slug       string `bson:"-"`
+	Rename     string `bson:"-"` // New display name, when it clashed with another
+	MoveImages bool   `bson:"-"` // Whether images.category can be moved to the slug
+}
+
+// planSlugs gives each legacy category a unique slug derived from its name.
+// Names that only differed by case ("Anime" and "anime") get a numbered slug
+// ("anime-2") and display name ("Anime (2)"). Names without letters or
+// digits get "category", numbered too when taken. slugs and names are those
+// of the other categories.
+//
+// Images reference their category by name until they are moved to its
+// slug. Names that are also another category's slug, or shared by two
+// legacy categories, can't tell their images apart, so those images are left
+// for the consistency report rather than merged into the wrong category.
+func planSlugs(slugs, names []string, legacy []legacyCategory) {
+	takenSlugs := make(map[string]bool)
+	for _, slug := range slugs {
+		takenSlugs[slug] = true
+	}
+	takenNames := make(map[string]bool)
+	for _, name := range names {
+		takenNames[strings.ToLower(name)] = true
+	}
+	nameCount := make(map[string]int)
+	for _, category := range legacy {
+		nameCount[category.Category]++
+	}
+
+	// Categories already named like a slug keep it, as their images need no
+	// move.
+	for i := range legacy {
+		name := legacy[i].Category
+		if name != "" && utils.Slugify(name) == name && !takenSlugs[name] {
+			legacy[i].Slug = name
+			takenSlugs[name] = true
+		}
+	}
+	for i := range legacy {
+		category := &legacy[i]
+		if category.Slug == "" {
+			base := utils.Slugify(category.Category)
+			if base == "" {
+				base = "category"
+			}
+			category.Slug = base
+			for n := 2; takenSlugs[category.Slug]; n++ {
+				category.Slug = fmt.Sprintf("%s-%d", base, n)
+			}
+			takenSlugs[category.Slug] = true
+		}
+
+		name := category.Category
+		for n := 2; takenNames[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s (%d)", category.Category, n)
+		}
+		takenNames[strings.ToLower(name)] = true
+		if name != category.Category {
+			category.Rename = name
+		}
+	}
+
+	for i := range legacy {
+		category := &legacy[i]
+		category.MoveImages = category.Slug != category.Category &&
+			!takenSlugs[category.Category] && nameCount[category.Category] == 1
+	}
+}
+
+// backfillCategorySlugs gives categories created before slugs existed one
+// derived from their name, and points their images at it.
+func backfillCategorySlugs(ctx context.Context) error {
+	db := Client.Database("imagestore")
+	categories := db.Collection("categories")
+
+	cursor, err := categories.Find(ctx, bson.M{"slug": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var legacy []legacyCategory
+	if err = cursor.All(ctx, &legacy); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	var slugs, names []string
+	if err = categories.Distinct(ctx, "slug", bson.M{"slug": bson.M{"$exists": true}}).Decode(&slugs); err != nil {
+		return err
+	}
+	if err = categories.Distinct(ctx, "category", bson.M{"slug": bson.M{"$exists": true}}).Decode(&names); err != nil {
+		return err
+	}
+	planSlugs(slugs, names, legacy)
+
+	for _, category := range legacy {
+		set := bson.M{"slug": category.Slug}
+		if category.Rename != "" {
+			log.Printf("Category %q renamed to %q, its name clashed with another", category.Category, category.Rename)
+			set["category"] = category.Rename
+		}
+		if _, err := categories.UpdateByID(ctx, category.ID, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		if category.Slug == category.Category {
+			continue
+		}
+		if !category.MoveImages {
+			log.Printf("Images of category %q left as they are, they can't be told apart from another category's", category.Category)
+			continue
+		}
+		_, err := db.Collection("images").UpdateMany(ctx,
+			bson.M{"category": category.Category}, bson.M{"$set": bson.M{"category": category.Slug}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillCategoryPaths makes categories created before subcategories existed
+// top level ones.
+func backfillCategoryPaths(ctx context.Context) error {
+	_, err := Client.Database("imagestore").Collection("categories").UpdateMany(ctx,
+		bson.M{"path": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"path": "$slug"}}}})
+	return err
+}
+
+// backfillImageStatus publishes images uploaded before the review workflow,
+// as they were already visible to everyone.
+func backfillImageStatus(ctx context.Context) error {
+	_, err := Client.Database("imagestore").Collection("images").UpdateMany(ctx,
+		bson.M{"status": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"status": "published", "published_at": "$uploaded_at"}}}})
+	return err
+}
+
+// backfillEmailVerified marks users registered before email verification as
+// verified, so they keep full access.
+func backfillEmailVerified(ctx context.Context) error {
+	_, err := Client.Database("imagestore").Collection("users").UpdateMany(ctx,
+		bson.M{"email_verified": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"email_verified": true}})
+	return err
+}
+
+// seedRoles creates the built-in roles the first time. The admin role is
+// also given every permission added since, so admins can never lock
+// themselves out of new features.
+func seedRoles(ctx context.Context) error {
+	roles := Client.Database("imagestore").Collection("roles")
+	now := time.Now()
+
+	_, err := roles.UpdateOne(ctx, bson.M{"_id": models.RoleAdmin},
+		bson.M{
+			"$addToSet":    bson.M{"permissions": bson.M{"$each": models.AllPermissions}},
+			"$setOnInsert": bson.M{"default": false, "updated_at": now},
+		},
+		options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	_, err = roles.UpdateOne(ctx, bson.M{"_id": models.RoleUser},
+		bson.M{"$setOnInsert": bson.M{"permissions": bson.A{}, "default": true, "updated_at": now}},
+		options.UpdateOne().SetUpsert(true))
+	return err
+}
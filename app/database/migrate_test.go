@@ -0,0 +1,55 @@
+package database
+
+import "testing"
+
+func TestPlanSlugs(t *testing.T) {
+	type want struct {
+		slug       string
+		rename     string
+		moveImages bool
+	}
+	tests := []struct {
+		name   string
+		slugs  []string // Of categories that already have one
+		names  []string
+		legacy []string
+		want   []want
+	}{
+		{
+			name:   "names differing by case",
+			legacy: []string{"Anime", "anime"},
+			// "anime" keeps its slug, its images need no move.
+			want: []want{{"anime-2", "", true}, {"anime", "anime (2)", false}},
+		},
+		{
+			name:   "no letters or digits",
+			legacy: []string{"!!!", "???"},
+			want:   []want{{"category", "", true}, {"category-2", "", true}},
+		},
+		{
+			name:   "slug taken by a newer category",
+			slugs:  []string{"anime"},
+			names:  []string{"Anime"},
+			legacy: []string{"anime"},
+			// Its images can't be told apart from the newer category's.
+			want: []want{{"anime-2", "anime (2)", false}},
+		},
+		{
+			name:   "same name twice",
+			legacy: []string{"Anime", "Anime"},
+			want:   []want{{"anime", "", false}, {"anime-2", "Anime (2)", false}},
+		},
+	}
+	for _, tt := range tests {
+		legacy := make([]legacyCategory, len(tt.legacy))
+		for i, name := range tt.legacy {
+			legacy[i].Category = name
+		}
+		planSlugs(tt.slugs, tt.names, legacy)
+		for i, category := range legacy {
+			if got := (want{category.Slug, category.Rename, category.MoveImages}); got != tt.want[i] {
+				t.Errorf("%s: %q planned as %+v, want %+v", tt.name, tt.legacy[i], got, tt.want[i])
+			}
+		}
+	}
+}
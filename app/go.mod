@@ -5,7 +5,9 @@ go 1.25.0
 require (
 	github.com/aws/aws-sdk-go-v2 v1.39.4
 	github.com/gin-gonic/gin v1.11.0
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
 	go.mongodb.org/mongo-driver/v2 v2.3.1
+	golang.org/x/image v0.31.0
 )
 
 require (
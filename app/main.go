@@ -4,7 +4,9 @@ import (
 	"ginmongo/controller"
 	"ginmongo/database"
 	"ginmongo/route"
+	"ginmongo/utils"
 	"log"
+	"os"
 	"strings"
 	"time"
 
@@ -22,12 +24,29 @@ func main() {
 
 	controller.InitS3Client()
 
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+
 	// Initialize MongoDB connection
 	if err := database.Connect(); err != nil {
 		log.Fatal("Failed to connect to MongoDB:", err)
 	}
 
+	// Handlers rely on the unique indexes, so don't serve without them.
+	if err := database.Migrate(); err != nil {
+		log.Fatal("Failed to migrate MongoDB:", err)
+	}
+
+	controller.InitStatsFlusher()
+	controller.InitPublishScheduler()
+
 	router := gin.Default()
+	// c.ClientIP(), which login throttling relies on, only trusts
+	// X-Forwarded-For from these proxies.
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
 	// router.Use(cors.New(cors.Config{
 	// 	AllowOrigins:     []string{"https://front:3000", "http://localhost:3001"}, // Allows all localhost ports
 	// 	AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -56,3 +75,16 @@ func main() {
 
 	router.Run(":8007")
 }
+
+// trustedProxies reads TRUSTED_PROXIES, a comma separated list of the IPs or
+// CIDRs of the reverse proxies in front of the API. None are trusted by
+// default.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
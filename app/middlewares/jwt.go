@@ -1,15 +1,18 @@
 package middlewares
 
 import (
-	"fmt"
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
 	"ginmongo/utils"
+	"log"
 	"net/http"
-	"os"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func JWT() gin.HandlerFunc {
@@ -34,54 +37,177 @@ func JWT() gin.HandlerFunc {
 
 	// 	// tokenString := parts[1]
 	return func(c *gin.Context) {
-		var tokenString string
-
-		// Try to get token from Authorization header first (for Postman/API clients)
-		authHeader := c.GetHeader("Authorization")
-		if authHeader != "" {
-			// Expecting format: "Bearer <token>"
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
-				tokenString = parts[1]
-			}
-		}
+		authenticate(c, true)
+	}
+}
+
+// OptionalJWT authenticates the caller like JWT when the request carries a
+// token and lets anonymous requests through without a Principal, for routes
+// that also serve public content.
+func OptionalJWT() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, false)
+	}
+}
 
-		// If not in header, try cookie (for browser)
-		if tokenString == "" {
-			tokenCookie, err := c.Request.Cookie("Bearer")
-			if err != nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Authorization token required",
-				})
-				return
-			}
-			tokenString = tokenCookie.Value
+func authenticate(c *gin.Context, required bool) {
+	// Authorization header first (for Postman/API clients), then the
+	// cookie (for browser)
+	tokenString := utils.BearerToken(c.Request)
+	if tokenString == "" {
+		if !required {
+			c.Next()
+			return
 		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": "Authorization token required",
+		})
+		return
+	}
 
-		jwtSecret := os.Getenv("JWT_SECRET")
-		claims := &utils.SignedDetails{}
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			// Ensure signing method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(jwtSecret), nil
-		})
+	if claims.ExpiresAt.Time.Before(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
+		return
+	}
+
+	revoked, err := isRevoked(c.Request.Context(), claims.ID)
+	if err != nil {
+		log.Println("Error checking token denylist:", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
+
+	disabled, err := isDisabled(c.Request.Context(), claims.UserID)
+	if err != nil {
+		log.Println("Error checking disabled users:", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if disabled {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account is disabled"})
+		return
+	}
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	if claims.SessionID != "" {
+		active, err := touchSession(c.Request.Context(), claims.SessionID)
+		if err != nil {
+			log.Println("Error checking session:", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 			return
 		}
-
-		if claims.ExpiresAt.Time.Before(time.Now()) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has expired"})
+		if !active {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked"})
 			return
 		}
+	}
 
-		c.Set("role", claims.Role)
-		//c.Set("userID", claims.)
+	c.Set(principalKey{}, models.Principal{
+		UserID:     claims.UserID,
+		Email:      claims.Email,
+		Role:       claims.Role,
+		SessionID:  claims.SessionID,
+		Unverified: claims.Unverified,
+	})
 
-		c.Next()
+	// Users who haven't verified their email can only read.
+	if claims.Unverified && !isReadOnly(c.Request.Method) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Verify your email address first"})
+		return
+	}
+
+	c.Next()
+}
+
+func isReadOnly(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// isRevoked checks the denylist of access tokens revoked before they expire,
+// e.g. on logout. Tokens issued before they carried a jti can't be revoked.
+func isRevoked(ctx context.Context, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	err := database.Client.Database("imagestore").Collection("revoked_tokens").FindOne(ctx, bson.M{"_id": jti}).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// disabledCacheTTL bounds how long a disabled account keeps working on other
+// instances for tokens without a session; this one drops its cache right away.
+const disabledCacheTTL = 30 * time.Second
+
+var disabledCache = struct {
+	sync.Mutex
+	loadedAt time.Time
+	users    map[string]bool
+}{}
+
+// InvalidateDisabledUsers makes the next request reload the disabled users.
+func InvalidateDisabledUsers() {
+	disabledCache.Lock()
+	defer disabledCache.Unlock()
+	disabledCache.users = nil
+}
+
+// isDisabled reports whether the account of userID has been disabled.
+func isDisabled(ctx context.Context, userID string) (bool, error) {
+	disabledCache.Lock()
+	defer disabledCache.Unlock()
+
+	if disabledCache.users == nil || time.Since(disabledCache.loadedAt) > disabledCacheTTL {
+		var ids []string
+		err := database.Client.Database("imagestore").Collection("users").
+			Distinct(ctx, "user_id", bson.M{"disabled": true}).Decode(&ids)
+		if err != nil {
+			return false, err
+		}
+		users := make(map[string]bool, len(ids))
+		for _, id := range ids {
+			users[id] = true
+		}
+		disabledCache.users = users
+		disabledCache.loadedAt = time.Now()
+	}
+	return disabledCache.users[userID], nil
+}
+
+// sessionSeenInterval limits how often a session's last_seen_at is written.
+const sessionSeenInterval = time.Minute
+
+// touchSession reports whether the session is still active and records that
+// it was just seen.
+func touchSession(ctx context.Context, sessionID string) (bool, error) {
+	sessions := database.Client.Database("imagestore").Collection("sessions")
+	var session models.Session
+	err := sessions.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) {
+		return false, nil
+	}
+
+	if time.Since(session.LastSeenAt) > sessionSeenInterval {
+		_, err = sessions.UpdateOne(ctx, bson.M{"_id": sessionID}, bson.M{"$set": bson.M{"last_seen_at": time.Now()}})
+		if err != nil {
+			log.Println("Error updating session:", err)
+		}
 	}
+	return true, nil
 }
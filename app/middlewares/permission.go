@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"context"
+	"ginmongo/database"
+	"ginmongo/models"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// roleCacheTTL bounds how long a role change takes to apply on other
+// instances; this one drops its cache right away.
+const roleCacheTTL = 30 * time.Second
+
+var roleCache = struct {
+	sync.Mutex
+	loadedAt    time.Time
+	permissions map[string]map[string]bool
+}{}
+
+// InvalidateRoles makes the next permission check reload the roles.
+func InvalidateRoles() {
+	roleCache.Lock()
+	defer roleCache.Unlock()
+	roleCache.permissions = nil
+}
+
+// rolePermissions returns the permissions granted to role.
+func rolePermissions(ctx context.Context, role string) (map[string]bool, error) {
+	roleCache.Lock()
+	defer roleCache.Unlock()
+
+	if roleCache.permissions == nil || time.Since(roleCache.loadedAt) > roleCacheTTL {
+		cursor, err := database.Client.Database("imagestore").Collection("roles").Find(ctx, bson.M{})
+		if err != nil {
+			return nil, err
+		}
+		var roles []models.Role
+		if err = cursor.All(ctx, &roles); err != nil {
+			return nil, err
+		}
+		permissions := make(map[string]map[string]bool, len(roles))
+		for _, r := range roles {
+			permissions[r.Name] = make(map[string]bool, len(r.Permissions))
+			for _, permission := range r.Permissions {
+				permissions[r.Name][permission] = true
+			}
+		}
+		roleCache.permissions = permissions
+		roleCache.loadedAt = time.Now()
+	}
+	return roleCache.permissions[role], nil
+}
+
+// HasPermission reports whether the caller's role grants permission.
+func HasPermission(c *gin.Context, permission string) bool {
+	principal, ok := CurrentPrincipal(c)
+	if !ok || principal.Role == "" {
+		return false
+	}
+	permissions, err := rolePermissions(c.Request.Context(), principal.Role)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println("Error loading roles:", err)
+		return false
+	}
+	return permissions[permission]
+}
+
+// RequirePermission rejects callers whose role lacks any of permissions. It
+// must run after JWT.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentPrincipal(c); !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization token required"})
+			return
+		}
+		for _, permission := range permissions {
+			if !HasPermission(c, permission) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Missing permission " + permission})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"ginmongo/models"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHasPermission(t *testing.T) {
+	// Fill the role cache, so the checks don't need MongoDB.
+	roleCache.Lock()
+	roleCache.permissions = map[string]map[string]bool{
+		"editor":        {models.PermImageUpload: true},
+		models.RoleUser: {},
+	}
+	roleCache.loadedAt = time.Now()
+	roleCache.Unlock()
+	t.Cleanup(InvalidateRoles)
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		want      bool
+	}{
+		{"granted", &models.Principal{UserID: "e", Role: "editor"}, true},
+		{"not granted", &models.Principal{UserID: "u", Role: models.RoleUser}, false},
+		{"unknown role", &models.Principal{UserID: "x", Role: "deleted"}, false},
+		{"anonymous", nil, false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		if tt.principal != nil {
+			c.Set(principalKey{}, *tt.principal)
+		}
+		if got := HasPermission(c, models.PermImageUpload); got != tt.want {
+			t.Errorf("%s: HasPermission = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package middlewares
+
+import (
+	"ginmongo/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey is the context key of the Principal, unexported so only the
+// JWT middleware can set it.
+type principalKey struct{}
+
+// CurrentPrincipal returns the caller authenticated by the JWT middleware.
+func CurrentPrincipal(c *gin.Context) (models.Principal, bool) {
+	value, exists := c.Get(principalKey{})
+	principal, ok := value.(models.Principal)
+	return principal, exists && ok
+}
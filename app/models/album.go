@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Album visibilities. Private albums are only visible to their owner,
+// unlisted ones to anyone with the link and public ones are also listed.
+const (
+	AlbumPrivate  = "private"
+	AlbumUnlisted = "unlisted"
+	AlbumPublic   = "public"
+)
+
+// Album is a user's own ordered selection of images from any category.
+type Album struct {
+	ID         bson.ObjectID   `json:"id" bson:"_id,omitempty"`
+	OwnerID    string          `json:"owner_id" bson:"owner_id"` // users.user_id of the creator
+	Name       string          `json:"name" bson:"name" validate:"required,max=100"`
+	Visibility string          `json:"visibility" bson:"visibility" validate:"omitempty,oneof=private unlisted public"`
+	ImageIDs   []bson.ObjectID `json:"image_ids" bson:"image_ids"` // In display order
+	CreatedAt  time.Time       `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at" bson:"updated_at"`
+}
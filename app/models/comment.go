@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Comment is one entry of an image's comment thread.
+type Comment struct {
+	ID        bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	ImageID   bson.ObjectID `json:"image_id" bson:"image_id"`
+	AuthorID  string        `json:"author_id" bson:"author_id"` // users.user_id, taken from the token
+	Body      string        `json:"body" bson:"body" validate:"required,max=2000"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	EditedAt  *time.Time    `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// Principal is the authenticated caller of a request, taken from the claims
+// of its access token by the JWT middleware.
+type Principal struct {
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	SessionID  string `json:"session_id,omitempty"` // Empty for tokens issued before sessions
+	Unverified bool   `json:"unverified,omitempty"` // Email not verified yet, limited to reading
+}
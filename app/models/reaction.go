@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Reaction kinds.
+const (
+	ReactionLike     = "like"
+	ReactionFavorite = "favorite"
+)
+
+// Reaction is one user's like or favorite of an image. There is at most one
+// of each kind per user and image.
+type Reaction struct {
+	ID        bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string        `json:"user_id" bson:"user_id"`
+	ImageID   bson.ObjectID `json:"image_id" bson:"image_id"`
+	Kind      string        `json:"kind" bson:"kind"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+}
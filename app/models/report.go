@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Report reasons.
+const (
+	ReportSpam          = "spam"
+	ReportInappropriate = "inappropriate"
+	ReportCopyright     = "copyright"
+	ReportViolence      = "violence"
+	ReportOther         = "other"
+)
+
+// Report statuses. Open reports are in the moderation queue until an admin
+// dismisses them or acts on the image.
+const (
+	ReportOpen      = "open"
+	ReportDismissed = "dismissed"
+	ReportActioned  = "actioned"
+)
+
+// Moderation actions.
+const (
+	ModerationDismiss = "dismiss"
+	ModerationHide    = "hide"
+	ModerationUnhide  = "unhide"
+	ModerationDelete  = "delete"
+	ModerationBan     = "ban_uploader"
+)
+
+// Report is one user's flag on an image.
+type Report struct {
+	ID         bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	ImageID    bson.ObjectID `json:"image_id" bson:"image_id"`
+	ReporterID string        `json:"reporter_id" bson:"reporter_id"`
+	Reason     string        `json:"reason" bson:"reason" validate:"required,oneof=spam inappropriate copyright violence other"`
+	Note       string        `json:"note,omitempty" bson:"note,omitempty" validate:"max=500"`
+	Status     string        `json:"status" bson:"status"`
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+	ResolvedAt *time.Time    `json:"resolved_at,omitempty" bson:"resolved_at,omitempty"`
+	ResolvedBy string        `json:"resolved_by,omitempty" bson:"resolved_by,omitempty"`
+}
+
+// ModerationAction is an audit trail entry for an admin action on an image.
+type ModerationAction struct {
+	ID           bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action       string        `json:"action" bson:"action" validate:"required,oneof=dismiss hide unhide delete ban_uploader"`
+	ActorID      string        `json:"actor_id" bson:"actor_id"`
+	ImageID      bson.ObjectID `json:"image_id" bson:"image_id"`
+	TargetUserID string        `json:"target_user_id,omitempty" bson:"target_user_id,omitempty"` // Uploader, for bans
+	Note         string        `json:"note,omitempty" bson:"note,omitempty" validate:"max=500"`
+	Reports      int64         `json:"reports" bson:"reports"` // Open reports resolved by the action
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Permissions checked by the routes. Roles grant a set of them.
+const (
+	PermImageUpload     = "image:upload"     // Upload images
+	PermImagePublish    = "image:publish"    // Publish uploads without review
+	PermImageReview     = "image:review"     // Review uploads and see unpublished images
+	PermImageModerate   = "image:moderate"   // Work the report queue, hide images and ban uploaders
+	PermImageDelete     = "image:delete"     // Delete images
+	PermCommentModerate = "comment:moderate" // Delete anyone's comments
+	PermCategoryManage  = "category:manage"  // Create, edit, order and repair categories
+	PermUserManage      = "user:manage"      // Manage user accounts
+	PermRoleManage      = "role:manage"      // Edit roles and their permissions
+)
+
+// AllPermissions lists every permission, in the order they are documented.
+var AllPermissions = []string{
+	PermImageUpload,
+	PermImagePublish,
+	PermImageReview,
+	PermImageModerate,
+	PermImageDelete,
+	PermCommentModerate,
+	PermCategoryManage,
+	PermUserManage,
+	PermRoleManage,
+}
+
+// Built-in roles, created on start when missing.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Role is a named set of permissions. Users hold one role, stored on
+// users.role and carried in their access tokens.
+type Role struct {
+	Name        string    `json:"name" bson:"_id"`
+	Permissions []string  `json:"permissions" bson:"permissions"`
+	Default     bool      `json:"default" bson:"default"` // Given to new registrations
+	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+}
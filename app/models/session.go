@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session is one login of a user on a device. Its ID is carried by the access
+// tokens (sid claim) and shared by the refresh token family of the login, so
+// revoking it logs that device out right away.
+type Session struct {
+	ID         string     `json:"id" bson:"_id"`
+	UserID     string     `json:"user_id" bson:"user_id"`
+	UserAgent  string     `json:"user_agent" bson:"user_agent"`
+	IP         string     `json:"ip" bson:"ip"`
+	CreatedAt  time.Time  `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at" bson:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"` // Pushed back on every refresh
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	Current    bool       `json:"current" bson:"-"` // Session of the request, in listings
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ImageStat holds the views and downloads of one image during one hour. The
+// popularity windows are summed from these rollups.
+type ImageStat struct {
+	ID        bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	ImageID   bson.ObjectID `json:"image_id" bson:"image_id"`
+	Hour      time.Time     `json:"hour" bson:"hour"` // Start of the hour, UTC
+	Views     int64         `json:"views" bson:"views"`
+	Downloads int64         `json:"downloads" bson:"downloads"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RefreshToken is one refresh token of a session. Each refresh replaces the
+// token with a new one of the same family, so presenting a used token means
+// it was stolen and the whole session gets revoked.
+type RefreshToken struct {
+	ID        bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID    string        `json:"user_id" bson:"user_id"`
+	FamilyID  string        `json:"family_id" bson:"family_id"` // ID of the session the token belongs to
+	TokenHash string        `json:"-" bson:"token_hash"`        // SHA-256 of the token, never the token itself
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time    `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	RevokedAt *time.Time    `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+// RevokedToken denylists an access token by its jti until it expires.
+type RevokedToken struct {
+	JTI       string    `json:"jti" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// AuthFailure counts failed credential checks for one key, e.g. the password
+// checks of a user, until ExpiresAt.
+type AuthFailure struct {
+	Key        string     `json:"key" bson:"_id"`
+	Count      int        `json:"count" bson:"count"`
+	LastAt     time.Time  `json:"last_at" bson:"last_at"`
+	PreviousAt *time.Time `json:"previous_at,omitempty" bson:"previous_at,omitempty"` // The check before LastAt, if counted too
+	ExpiresAt  time.Time  `json:"expires_at" bson:"expires_at"`
+}
@@ -6,12 +6,62 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// Image statuses. Only published images are listed to non-admins. A draft
+// with a publish_at is scheduled and gets published once that time passes.
+const (
+	ImageDraft         = "draft"
+	ImagePendingReview = "pending_review"
+	ImagePublished     = "published"
+	ImageArchived      = "archived"
+)
+
 // Image represents an image stored in S3 with metadata in MongoDB
 type Image struct {
-	ID         bson.ObjectID `json:"id" bson:"_id,omitempty"`
-	Category   string        `json:"category" bson:"category"` // e.g., "anime", "games"
-	FileName   string        `json:"file_name" bson:"file_name"`
-	S3Key      string        `json:"s3_key" bson:"s3_key"` // Full S3 path: anime/image.jpg
-	S3URL      string        `json:"s3_url" bson:"s3_url"` // Full accessible URL
-	UploadedAt time.Time     `json:"uploaded_at" bson:"uploaded_at"`
+	ID            bson.ObjectID `json:"id" bson:"_id,omitempty"`
+	Category      string        `json:"category" bson:"category"` // e.g., "anime", "games"
+	FileName      string        `json:"file_name" bson:"file_name"`
+	S3Key         string        `json:"s3_key" bson:"s3_key"` // Full S3 path: images/<id>/image.jpg, anime/image.jpg before
+	S3URL         string        `json:"s3_url" bson:"s3_url"` // Full accessible URL
+	Tags          []string      `json:"tags,omitempty" bson:"tags,omitempty"`
+	Palette       []ColorSwatch `json:"palette,omitempty" bson:"palette,omitempty"` // Dominant colors, heaviest first
+	Width         int           `json:"width,omitempty" bson:"width,omitempty"`
+	Height        int           `json:"height,omitempty" bson:"height,omitempty"`
+	BlurHash      string        `json:"blurhash,omitempty" bson:"blurhash,omitempty"`
+	LQIP          string        `json:"lqip,omitempty" bson:"lqip,omitempty"`         // Tiny base64 JPEG data URI
+	Location      *GeoPoint     `json:"location,omitempty" bson:"location,omitempty"` // From EXIF GPS, unless stripped
+	NameNgrams    []string      `json:"-" bson:"name_ngrams,omitempty"`               // Trigrams of the file name for fuzzy search
+	TakenAt       *time.Time    `json:"taken_at,omitempty" bson:"taken_at,omitempty"` // EXIF DateTimeOriginal
+	LikeCount     int64         `json:"like_count" bson:"like_count"`
+	FavoriteCount int64         `json:"favorite_count" bson:"favorite_count"`
+	ViewCount     int64         `json:"view_count" bson:"view_count"`
+	DownloadCount int64         `json:"download_count" bson:"download_count"`
+	CommentCount  int64         `json:"comment_count" bson:"comment_count"`
+	UploadedBy    string        `json:"uploaded_by,omitempty" bson:"uploaded_by,omitempty"` // users.user_id of the uploader
+	Hidden        bool          `json:"hidden,omitempty" bson:"hidden,omitempty"`           // Hidden by a moderator
+	Status        string        `json:"status" bson:"status"`
+	PublishAt     *time.Time    `json:"publish_at,omitempty" bson:"publish_at,omitempty"` // Scheduled publication of a draft
+	PublishedAt   *time.Time    `json:"published_at,omitempty" bson:"published_at,omitempty"`
+	ReviewNote    string        `json:"review_note,omitempty" bson:"review_note,omitempty"` // Reason given when a review is rejected
+	UploadedAt    time.Time     `json:"uploaded_at" bson:"uploaded_at"`
+}
+
+// ColorSwatch is one dominant color of an image. Weight is the share of the
+// image covered by the color; L, A and B are its CIE Lab coordinates used by
+// the color filter.
+type ColorSwatch struct {
+	Hex    string  `json:"hex" bson:"hex"`
+	Weight float64 `json:"weight" bson:"weight"`
+	L      float64 `json:"-" bson:"l"`
+	A      float64 `json:"-" bson:"a"`
+	B      float64 `json:"-" bson:"b"`
+}
+
+// GeoPoint is a GeoJSON point. Coordinates are [longitude, latitude].
+type GeoPoint struct {
+	Type        string    `json:"type" bson:"type"`
+	Coordinates []float64 `json:"coordinates" bson:"coordinates"`
+}
+
+func NewGeoPoint(lat, lng float64) *GeoPoint {
+	return &GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
 }
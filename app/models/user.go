@@ -7,17 +7,22 @@ import (
 )
 
 type User struct {
-	ID                   bson.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
-	UserID               string        `json:"user_id,omitempty" bson:"user_id"`
-	FirstName            string        `json:"first_name,omitempty" bson:"first_name,omitempty" validate:"required"`
-	LastName             string        `json:"last_name,omitempty" bson:"last_name,omitempty" validate:"required"`
-	Email                string        `json:"email,omitempty" bson:"email,omitempty" validate:"required,email"`
-	Password             string        `json:"password,omitempty" bson:"password,omitempty" validate:"required"`
-	Role                 string        `json:"role,,omitempty" bson:"role,,omitempty"`
-	CreatedAt            time.Time     `json:"created_at,omitempty" bson:"created_at,omitempty"`
-	UpdatedAt            time.Time     `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
-	PasswordResetToken   string        `json:"password_reset_token,omitempty" bson:"password_reset_token,omitempty"`
-	PasswordTokenExpired time.Time     `json:"password_token_expired,omitempty" bson:"password_token_expired,omitempty"`
+	ID                    bson.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
+	UserID                string        `json:"user_id,omitempty" bson:"user_id"`
+	FirstName             string        `json:"first_name,omitempty" bson:"first_name,omitempty" validate:"required"`
+	LastName              string        `json:"last_name,omitempty" bson:"last_name,omitempty" validate:"required"`
+	Email                 string        `json:"email,omitempty" bson:"email,omitempty" validate:"required,email"`
+	Password              string        `json:"password,omitempty" bson:"password,omitempty" validate:"required"`
+	Role                  string        `json:"role,,omitempty" bson:"role,,omitempty"`
+	CreatedAt             time.Time     `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt             time.Time     `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	PasswordResetToken    string        `json:"password_reset_token,omitempty" bson:"password_reset_token,omitempty"`
+	PasswordTokenExpired  time.Time     `json:"password_token_expired,omitempty" bson:"password_token_expired,omitempty"`
+	Disabled              bool          `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	PasswordResetRequired bool          `json:"password_reset_required,omitempty" bson:"password_reset_required,omitempty"` // Set by an admin, blocks login until the password is reset
+	EmailVerified         bool          `json:"email_verified" bson:"email_verified"`
+	PendingEmail          string        `json:"pending_email,omitempty" bson:"pending_email,omitempty"` // Replaces Email once verified
+	VerificationSentAt    *time.Time    `json:"-" bson:"verification_sent_at,omitempty"`                // Last verification email, for throttling resends
 }
 
 type UserLogin struct {
@@ -40,6 +45,26 @@ type PasswordUpdate struct {
 }
 
 type Category struct {
-	ID       bson.ObjectID `json:"_id,omitempty"  bson:"_id,omitempty"`
-	Category string        `json:"category,omitempty" bson:"category,omitempty"`
+	ID           bson.ObjectID  `json:"_id,omitempty"  bson:"_id,omitempty"`
+	Category     string         `json:"category,omitempty" bson:"category,omitempty"` // Display name
+	Slug         string         `json:"slug,omitempty" bson:"slug,omitempty"`         // URL safe key, stored on images.category
+	Parent       string         `json:"parent,omitempty" bson:"parent,omitempty"`     // Slug of the parent category, empty at the top level
+	Path         string         `json:"path,omitempty" bson:"path,omitempty"`         // Slugs from the root down to this category: games/rpg/elden-ring
+	Description  string         `json:"description,omitempty" bson:"description,omitempty"`
+	CoverImageID *bson.ObjectID `json:"cover_image_id,omitempty" bson:"cover_image_id,omitempty"` // Falls back to the newest image when unset
+	SortOrder    int            `json:"sort_order" bson:"sort_order"`
+	Visibility   string         `json:"visibility,omitempty" bson:"visibility,omitempty"` // Who can read it, members when unset
+	AllowedUsers []string       `json:"-" bson:"allowed_users,omitempty"`                 // user_ids that can read a restricted category. The lists are only served by the access endpoints
+	AllowedRoles []string       `json:"-" bson:"allowed_roles,omitempty"`                 // Roles whose users can read a restricted category
+	Contributors []string       `json:"-" bson:"contributors,omitempty"`                  // user_ids that can upload here without image:upload
+	UpdatedAt    time.Time      `json:"updated_at,omitempty" bson:"updated_at,omitempty"` // Last edit or upload
 }
+
+// Category visibilities. Public categories can be read without logging in,
+// members categories by every user and restricted ones only by the users and
+// roles they allow, plus their contributors.
+const (
+	CategoryPublic     = "public"
+	CategoryMembers    = "members"
+	CategoryRestricted = "restricted"
+)
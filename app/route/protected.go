@@ -3,19 +3,83 @@ package route
 import (
 	"ginmongo/controller"
 	mw "ginmongo/middlewares"
+	"ginmongo/models"
 
 	"github.com/gin-gonic/gin"
 )
 
 func Protected(router *gin.Engine) {
 
+	// Listings serve public categories to anonymous callers too; handlers
+	// only return what the caller can read.
+	optional := router.Group("/")
+
+	optional.Use(mw.OptionalJWT())
+	optional.GET("/images/:category", controller.GetImagesByCategory)
+	optional.GET("/images", controller.GetAllImages)
+	optional.GET("/images/search", controller.GetImagesByName)
+	optional.GET("/images/near", controller.GetImagesNear)
+	optional.GET("/images/within", controller.GetImagesWithin)
+	optional.GET("/images/timeline", controller.GetTimeline)
+	optional.GET("/images/popular", controller.GetPopularImages)
+	optional.GET("/search/suggest", controller.SearchSuggest)
+	optional.GET("/images/:category/download", controller.DownloadImage)
+	optional.GET("/images/:category/comments", controller.GetComments)
+	optional.GET("/category", controller.GetCategories)
+	optional.GET("/category/tree", controller.GetCategoryTree)
+
 	protected := router.Group("/")
 
 	protected.Use(mw.JWT())
 	protected.POST("/upload/:category", controller.UploadImage)
-	protected.GET("/images/:category", controller.GetImagesByCategory)
-	protected.GET("/images", controller.GetAllImages)
-	protected.GET("/images/search", controller.GetImagesByName)
-	protected.GET("/category", controller.GetCategories)
-	protected.POST("/category", controller.CreateCategory)
+	protected.PUT("/images/:category/like", controller.LikeImage)
+	protected.DELETE("/images/:category/like", controller.UnlikeImage)
+	protected.PUT("/images/:category/favorite", controller.FavoriteImage)
+	protected.DELETE("/images/:category/favorite", controller.UnfavoriteImage)
+	protected.POST("/images/:category/view", controller.RecordImageView)
+	protected.POST("/images/:category/comments", controller.CreateComment)
+	protected.PATCH("/images/:category/comments/:comment_id", controller.UpdateComment)
+	protected.DELETE("/images/:category/comments/:comment_id", controller.DeleteComment)
+	protected.POST("/images/:category/report", controller.ReportImage)
+	protected.PUT("/images/:category/status", mw.RequirePermission(models.PermImageReview), controller.SetImageStatus)
+	protected.GET("/me", controller.GetMe)
+	protected.PATCH("/me", controller.UpdateMe)
+	protected.PUT("/me/password", controller.UpdatePassword)
+	protected.PUT("/me/email", controller.ChangeEmail)
+	protected.POST("/users/:user_id", controller.UpdatePassword)
+	protected.GET("/me/uploads", controller.GetMyUploads)
+	protected.GET("/me/favorites", controller.GetMyFavorites)
+	protected.GET("/me/sessions", controller.GetSessions)
+	protected.DELETE("/me/sessions/:id", controller.RevokeSession)
+	protected.DELETE("/me/sessions", controller.RevokeAllSessions)
+	protected.POST("/category", mw.RequirePermission(models.PermCategoryManage), controller.CreateCategory)
+	protected.PATCH("/category/:slug", mw.RequirePermission(models.PermCategoryManage), controller.UpdateCategory)
+	protected.DELETE("/category/:slug", mw.RequirePermission(models.PermCategoryManage), controller.DeleteCategory)
+	protected.PUT("/category/order", mw.RequirePermission(models.PermCategoryManage), controller.ReorderCategories)
+	protected.PUT("/category/:slug/cover", mw.RequirePermission(models.PermCategoryManage), controller.SetCategoryCover)
+	protected.GET("/category/:slug/access", mw.RequirePermission(models.PermCategoryManage), controller.GetCategoryAccess)
+	protected.PUT("/category/:slug/access", mw.RequirePermission(models.PermCategoryManage), controller.SetCategoryAccess)
+	protected.POST("/albums", controller.CreateAlbum)
+	protected.GET("/albums", controller.GetAlbums)
+	protected.GET("/albums/:id", controller.GetAlbum)
+	protected.PATCH("/albums/:id", controller.UpdateAlbum)
+	protected.DELETE("/albums/:id", controller.DeleteAlbum)
+	protected.POST("/albums/:id/images", controller.AddAlbumImages)
+	protected.PUT("/albums/:id/images/order", controller.ReorderAlbumImages)
+	protected.DELETE("/albums/:id/images/:image_id", controller.RemoveAlbumImage)
+	protected.GET("/admin/categories/consistency", mw.RequirePermission(models.PermCategoryManage), controller.GetCategoryConsistency)
+	protected.POST("/admin/categories/repair", mw.RequirePermission(models.PermCategoryManage), controller.RepairCategories)
+	protected.GET("/admin/moderation/reports", mw.RequirePermission(models.PermImageModerate), controller.GetModerationQueue)
+	protected.POST("/admin/moderation/images/:image_id", mw.RequirePermission(models.PermImageModerate), controller.ModerateImage)
+	protected.GET("/admin/moderation/audit", mw.RequirePermission(models.PermImageModerate), controller.GetModerationAudit)
+	protected.GET("/admin/review", mw.RequirePermission(models.PermImageReview), controller.GetReviewQueue)
+	protected.POST("/admin/review/:image_id", mw.RequirePermission(models.PermImageReview), controller.ReviewImage)
+	protected.GET("/admin/roles", mw.RequirePermission(models.PermRoleManage), controller.GetRoles)
+	protected.PUT("/admin/roles/:name", mw.RequirePermission(models.PermRoleManage), controller.PutRole)
+	protected.DELETE("/admin/roles/:name", mw.RequirePermission(models.PermRoleManage), controller.DeleteRole)
+	protected.GET("/admin/users", mw.RequirePermission(models.PermUserManage), controller.GetUsers)
+	protected.PATCH("/admin/users/:id", mw.RequirePermission(models.PermUserManage), controller.UpdateUser)
+	protected.DELETE("/admin/users/:id", mw.RequirePermission(models.PermUserManage), controller.DeleteUser)
+	protected.POST("/admin/users/:id/password-reset", mw.RequirePermission(models.PermUserManage), controller.ForcePasswordReset)
+	protected.POST("/admin/users/:id/unlock", mw.RequirePermission(models.PermUserManage), controller.UnlockUser)
 }
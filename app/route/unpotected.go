@@ -10,8 +10,11 @@ func Unprotected(router *gin.Engine) {
 	router.POST("/registration", controller.RegisterUser)
 	router.POST("/login", controller.Login)
 	router.POST("/logout", controller.Logout)
+	router.POST("/token/refresh", controller.RefreshToken)
+	router.GET("/.well-known/jwks.json", controller.GetJWKS)
+	router.POST("/verify-email/resend", controller.ResendVerification)
+	router.POST("/verify-email/:token", controller.VerifyEmail)
 	router.POST("/forgetpassword", controller.ForgetPassword)
 	router.POST("/users/resetpassword/reset/:resetcode", controller.ResetPassword)
-	router.POST("/users/:user_id", controller.UpdatePassword)
 
 }
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"ginmongo/models"
+	"image"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxPaletteSamples caps how many pixels are clustered, so large wallpapers
+// cost the same as thumbnails.
+const maxPaletteSamples = 4096
+
+// ParseHexColor parses "#1e90ff", "1e90ff" or "#19f".
+func ParseHexColor(hex string) (r, g, b uint8, err error) {
+	hex = strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return 0, 0, 0, errors.New("color must be a hex value like #1e90ff")
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, 0, 0, errors.New("color must be a hex value like #1e90ff")
+	}
+	return uint8(value >> 16), uint8(value >> 8), uint8(value), nil
+}
+
+// RGBToLab converts an sRGB color to CIE L*a*b* (D65), where the euclidean
+// distance between two colors roughly follows how different they look.
+func RGBToLab(r, g, b uint8) (l, a, bb float64) {
+	lr, lg, lb := srgbToLinear(r), srgbToLinear(g), srgbToLinear(b)
+
+	x := (lr*0.4124 + lg*0.3576 + lb*0.1805) / 0.95047
+	y := lr*0.2126 + lg*0.7152 + lb*0.0722
+	z := (lr*0.0193 + lg*0.1192 + lb*0.9505) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+type paletteSample struct {
+	l, a, b          float64
+	red, green, blue float64
+}
+
+func (s paletteSample) distance(o paletteSample) float64 {
+	return (s.l-o.l)*(s.l-o.l) + (s.a-o.a)*(s.a-o.a) + (s.b-o.b)*(s.b-o.b)
+}
+
+// ExtractPalette clusters the pixels of img in Lab space with k-means and
+// returns up to k dominant colors, heaviest first. Fully transparent pixels
+// are ignored.
+func ExtractPalette(img image.Image, k int) []models.ColorSwatch {
+	bounds := img.Bounds()
+	step := int(math.Ceil(math.Sqrt(float64(bounds.Dx()*bounds.Dy()) / maxPaletteSamples)))
+	step = max(step, 1)
+
+	var samples []paletteSample
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += step {
+		for x := bounds.Min.X; x < bounds.Max.X; x += step {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a == 0 {
+				continue
+			}
+			r8, g8, b8 := uint8(r>>8), uint8(g>>8), uint8(b>>8)
+			l, la, lb := RGBToLab(r8, g8, b8)
+			samples = append(samples, paletteSample{l, la, lb, float64(r8), float64(g8), float64(b8)})
+		}
+	}
+	if len(samples) == 0 || k < 1 {
+		return nil
+	}
+	k = min(k, len(samples))
+
+	// k-means++ seeding with a fixed seed so the same image always gets the
+	// same palette.
+	rng := rand.New(rand.NewPCG(1, 2))
+	centers := []paletteSample{samples[rng.IntN(len(samples))]}
+	nearest := make([]float64, len(samples))
+	for len(centers) < k {
+		sum := 0.0
+		for i, s := range samples {
+			nearest[i] = math.MaxFloat64
+			for _, c := range centers {
+				nearest[i] = min(nearest[i], s.distance(c))
+			}
+			sum += nearest[i]
+		}
+		if sum == 0 {
+			break
+		}
+		target := rng.Float64() * sum
+		for i := range samples {
+			target -= nearest[i]
+			if target <= 0 {
+				centers = append(centers, samples[i])
+				break
+			}
+		}
+	}
+
+	assignment := make([]int, len(samples))
+	counts := make([]int, len(centers))
+	for iteration := 0; iteration < 10; iteration++ {
+		for i, s := range samples {
+			best, bestDistance := 0, math.MaxFloat64
+			for j, c := range centers {
+				if d := s.distance(c); d < bestDistance {
+					best, bestDistance = j, d
+				}
+			}
+			assignment[i] = best
+		}
+
+		sums := make([]paletteSample, len(centers))
+		clear(counts)
+		for i, s := range samples {
+			j := assignment[i]
+			sums[j].l += s.l
+			sums[j].a += s.a
+			sums[j].b += s.b
+			sums[j].red += s.red
+			sums[j].green += s.green
+			sums[j].blue += s.blue
+			counts[j]++
+		}
+		for j := range centers {
+			if counts[j] == 0 {
+				continue
+			}
+			n := float64(counts[j])
+			centers[j] = paletteSample{sums[j].l / n, sums[j].a / n, sums[j].b / n, sums[j].red / n, sums[j].green / n, sums[j].blue / n}
+		}
+	}
+
+	palette := make([]models.ColorSwatch, 0, len(centers))
+	for j, c := range centers {
+		if counts[j] == 0 {
+			continue
+		}
+		palette = append(palette, models.ColorSwatch{
+			Hex:    fmt.Sprintf("#%02x%02x%02x", uint8(math.Round(c.red)), uint8(math.Round(c.green)), uint8(math.Round(c.blue))),
+			Weight: math.Round(float64(counts[j])/float64(len(samples))*1000) / 1000,
+			L:      c.l,
+			A:      c.a,
+			B:      c.b,
+		})
+	}
+	sort.Slice(palette, func(i, j int) bool { return palette[i].Weight > palette[j].Weight })
+	return palette
+}
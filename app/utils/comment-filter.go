@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// CommentFilter checks a comment before it is saved. Check returns an error,
+// shown to the author, when the comment is rejected.
+type CommentFilter interface {
+	Check(body string) error
+}
+
+// CommentFilters runs every filter in order and stops at the first rejection.
+type CommentFilters []CommentFilter
+
+func (filters CommentFilters) Check(body string) error {
+	for _, filter := range filters {
+		if err := filter.Check(body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WordFilter rejects comments containing any of its words as a whole word,
+// ignoring case.
+type WordFilter struct {
+	words map[string]bool
+}
+
+func NewWordFilter(words []string) WordFilter {
+	filter := WordFilter{words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			filter.words[word] = true
+		}
+	}
+	return filter
+}
+
+func (filter WordFilter) Check(body string) error {
+	for _, word := range strings.FieldsFunc(strings.ToLower(body), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if filter.words[word] {
+			return errors.New("Comment contains blocked words")
+		}
+	}
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+|\b[a-z0-9-]+\.(com|net|org|io|xyz|ru|info|biz)\b`)
+
+// LinkFilter rejects comments containing URLs or bare domain names.
+type LinkFilter struct{}
+
+func (LinkFilter) Check(body string) error {
+	if linkPattern.MatchString(body) {
+		return errors.New("Links are not allowed in comments")
+	}
+	return nil
+}
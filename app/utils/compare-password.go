@@ -21,12 +21,12 @@ func ComparePass(password, hashPassword string) error {
 	salt, err := base64.StdEncoding.DecodeString(saltBase64)
 	if err != nil {
 		log.Println(err)
-		return nil
+		return err
 	}
 	hash, err := base64.StdEncoding.DecodeString(hashBase64)
 	if err != nil {
 		log.Println(err)
-		return nil
+		return err
 	}
 	Hash := argon2.IDKey([]byte(password), salt, 1, 64*1024, 4, 32)
 
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// NormalizeFileName lowercases a file name, drops the extension and turns
+// separators into single spaces: "God_of-War.JPG" -> "god of war".
+func NormalizeFileName(name string) string {
+	return NormalizeQuery(strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// NormalizeQuery is NormalizeFileName for search terms, which have no
+// extension: "Dr. Stone" -> "dr stone".
+func NormalizeQuery(query string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// NameNgrams returns the padded trigrams of every word in a file name. They
+// are stored on the image so candidates for a fuzzy search can be found with
+// a plain $in query.
+func NameNgrams(name string) []string {
+	return ngrams(NormalizeFileName(name))
+}
+
+// QueryNgrams returns the trigrams to look up for a search term.
+func QueryNgrams(query string) []string {
+	return ngrams(NormalizeQuery(query))
+}
+
+func ngrams(normalized string) []string {
+	seen := make(map[string]bool)
+	var grams []string
+
+	for _, word := range strings.Fields(normalized) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			gram := string(padded[i : i+3])
+			if !seen[gram] {
+				seen[gram] = true
+				grams = append(grams, gram)
+			}
+		}
+	}
+	sort.Strings(grams)
+	return grams
+}
+
+// Levenshtein returns the edit distance between a and b.
+func Levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// allowedTypos is how many edits a query word of the given length may be
+// away from a word in the name and still count as a match.
+func allowedTypos(length int) int {
+	switch {
+	case length <= 2:
+		return 0
+	case length <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// FuzzyScore reports whether every word of query matches some word of name,
+// either as a prefix or within a few typos, and how close the match is
+// (1 is an exact match). "narto" matches "naruto" with a score of about 0.83.
+func FuzzyScore(query, name string) (float64, bool) {
+	queryWords := strings.Fields(NormalizeQuery(query))
+	nameWords := strings.Fields(NormalizeFileName(name))
+	if len(queryWords) == 0 || len(nameWords) == 0 {
+		return 0, false
+	}
+
+	// Keep the old behaviour of "god war" matching "godwar" and "god-war".
+	if strings.Contains(strings.Join(nameWords, ""), strings.Join(queryWords, "")) {
+		return 1, true
+	}
+
+	total := 0.0
+	for _, q := range queryWords {
+		best := -1.0
+		for _, n := range nameWords {
+			if strings.HasPrefix(n, q) {
+				best = 1
+				break
+			}
+			distance := Levenshtein(q, n)
+			if distance > allowedTypos(len([]rune(q))) {
+				continue
+			}
+			score := 1 - float64(distance)/float64(max(len([]rune(q)), len([]rune(n))))
+			if score > best {
+				best = score
+			}
+		}
+		if best < 0 {
+			return 0, false
+		}
+		total += best
+	}
+	return total / float64(len(queryWords)), true
+}
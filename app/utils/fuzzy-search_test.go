@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "abc", 3},
+		{"naruto", "naruto", 0},
+		{"narto", "naruto", 1},
+		{"kitten", "sitting", 3},
+		{"é", "e", 1},
+	}
+	for _, tt := range tests {
+		if got := Levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("Levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query, name string
+		wantOK      bool
+		wantScore   float64
+	}{
+		{"naruto", "Naruto_Uzumaki.jpg", true, 1},
+		{"god war", "god-of-war.png", true, 1},
+		{"naru", "naruto.png", true, 1},
+		{"dr. stone", "Dr_Stone.png", true, 1},
+		{"narto", "naruto.png", true, 1 - 1.0/6},
+		{"ab", "ac.png", false, 0},
+		{"naruto zelda", "naruto.png", false, 0},
+		{"", "naruto.png", false, 0},
+	}
+	for _, tt := range tests {
+		score, ok := FuzzyScore(tt.query, tt.name)
+		if ok != tt.wantOK || math.Abs(score-tt.wantScore) > 1e-9 {
+			t.Errorf("FuzzyScore(%q, %q) = %v, %v, want %v, %v", tt.query, tt.name, score, ok, tt.wantScore, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one asymmetric key of the keyring, named by its kid.
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// keyring holds the keys tokens are signed and verified with. Tokens are
+// signed with the active key and verified with any key still in the keyring,
+// so a new key can be rolled out before the old one is removed.
+type keyring struct {
+	active      *signingKey
+	keys        map[string]*signingKey
+	hmacSecret  []byte
+	legacyUntil time.Time // HS256 tokens are accepted until then
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// loadKeyring reads every private key in JWT_KEYS_DIR, one PEM file per key
+// named <kid>.pem, and signs with JWT_SIGNING_KID (the last kid by name when
+// unset). Without JWT_KEYS_DIR tokens are signed with the JWT_SECRET HMAC key
+// as before. JWT_LEGACY_HS256_UNTIL (RFC 3339) keeps accepting HMAC tokens
+// during a migration to asymmetric keys.
+var loadKeyring = sync.OnceValues(func() (*keyring, error) {
+	ring := &keyring{
+		keys:       make(map[string]*signingKey),
+		hmacSecret: []byte(os.Getenv("JWT_SECRET")),
+	}
+	if until := os.Getenv("JWT_LEGACY_HS256_UNTIL"); until != "" {
+		parsed, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, errors.New("JWT_LEGACY_HS256_UNTIL must be an RFC 3339 time")
+		}
+		if len(ring.hmacSecret) == 0 {
+			return nil, errors.New("JWT_LEGACY_HS256_UNTIL needs the JWT_SECRET the legacy tokens were signed with")
+		}
+		ring.legacyUntil = parsed
+	}
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		return ring, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .pem keys in %s", dir)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		key, err := readSigningKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ring.keys[key.kid] = key
+		ring.active = key
+	}
+	if kid := os.Getenv("JWT_SIGNING_KID"); kid != "" {
+		if ring.active = ring.keys[kid]; ring.active == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KID %s is not in %s", kid, dir)
+		}
+	}
+	return ring, nil
+})
+
+func readSigningKey(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	var parsed any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{kid: strings.TrimSuffix(filepath.Base(file), ".pem")}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+	return key, nil
+}
+
+// LoadSigningKeys loads the keyring, so a broken key setup fails at start
+// rather than on the first login.
+func LoadSigningKeys() error {
+	_, err := loadKeyring()
+	return err
+}
+
+// signToken signs claims with the active key, or the HMAC secret when no
+// asymmetric keys are configured.
+func signToken(claims jwt.Claims) (string, error) {
+	ring, err := loadKeyring()
+	if err != nil {
+		return "", err
+	}
+	if ring.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ring.hmacSecret)
+	}
+	token := jwt.NewWithClaims(ring.active.method, claims)
+	token.Header["kid"] = ring.active.kid
+	return token.SignedString(ring.active.private)
+}
+
+// verificationKey returns the key to check token's signature with.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	ring, err := loadKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if ring.active != nil && time.Now().After(ring.legacyUntil) {
+			return nil, errors.New("HS256 tokens are no longer accepted")
+		}
+		if len(ring.hmacSecret) == 0 {
+			return nil, errors.New("no JWT_SECRET to verify HS256 tokens with")
+		}
+		return ring.hmacSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key := ring.keys[kid]
+	if key == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.private.Public(), nil
+}
+
+// JWKS returns the public keys of the keyring, for other services to verify
+// tokens with.
+func JWKS() ([]JWK, error) {
+	ring, err := loadKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	kids := make([]string, 0, len(ring.keys))
+	for kid := range ring.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	keys := make([]JWK, 0, len(kids))
+	for _, kid := range kids {
+		key := ring.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		keys = append(keys, jwk)
+	}
+	return keys, nil
+}
@@ -1,41 +1,102 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"log"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type SignedDetails struct {
+	UserID    string `json:"user_id"`
 	Email     string `json:"email"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	// Unverified is set for users who haven't verified their email yet.
+	Unverified bool `json:"unverified,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func SignedToken(email, firstName, lastName, role string) (string, error) {
+// AccessTokenTTL is how long access tokens are valid, ACCESS_TOKEN_MINUTES
+// (15 by default). Clients renew them with their refresh token.
+func AccessTokenTTL() time.Duration {
+	if minutes, err := strconv.Atoi(os.Getenv("ACCESS_TOKEN_MINUTES")); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 15 * time.Minute
+}
+
+func SignedToken(userID, email, firstName, lastName, role, sessionID string, unverified bool) (string, error) {
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		log.Println(err)
+		return "", errors.New("Error in signing")
+	}
 
-	secret := os.Getenv("JWT_SECRET")
 	claims := &SignedDetails{
-		Email:     email,
-		FirstName: firstName,
-		LastName:  lastName,
-		Role:      role,
+		UserID:     userID,
+		Email:      email,
+		FirstName:  firstName,
+		LastName:   lastName,
+		Role:       role,
+		SessionID:  sessionID,
+		Unverified: unverified,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
 			Issuer:    "imagesearch",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(1 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL())),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(secret))
+	signedToken, err := signToken(claims)
 	if err != nil {
 		log.Println(err)
 		return "", errors.New("Error in signing")
 	}
 	return signedToken, nil
 }
+
+// ParseToken verifies an access token and returns its claims.
+func ParseToken(tokenString string) (*SignedDetails, error) {
+	claims := &SignedDetails{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	// Access tokens have no audience; other tokens signed with the same
+	// keys, like email verification tokens, do.
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// BearerToken returns the access token of a request, from the Authorization
+// header (API clients) or else the Bearer cookie (browsers).
+func BearerToken(r *http.Request) string {
+	if authHeader := r.Header.Get("Authorization"); authHeader != "" {
+		// Expecting format: "Bearer <token>"
+		parts := strings.SplitN(authHeader, " ", 2)
+		if len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+			return parts[1]
+		}
+	}
+	if cookie, err := r.Cookie("Bearer"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"os"
+)
+
+// SendMail sends a plain text email to one recipient through the SMTP_HOST
+// server, authenticating as SMTP_USER.
+func SendMail(to, subject, body string) error {
+	smtpUser := os.Getenv("SMTP_USER")
+	smtpHost := os.Getenv("SMTP_HOST")
+	smtpPort := os.Getenv("SMTP_PORT")
+	smtpPass := os.Getenv("SMTP_PASSWORD")
+
+	smtpClient, err := smtp.Dial(smtpHost + ":" + smtpPort)
+	if err != nil {
+		return err
+	}
+	defer smtpClient.Close()
+
+	if err = smtpClient.StartTLS(&tls.Config{ServerName: smtpHost}); err != nil {
+		return err
+	}
+	if err = smtpClient.Auth(smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)); err != nil {
+		return err
+	}
+	// Set the sender and recipient first
+	if err = smtpClient.Mail(smtpUser); err != nil {
+		return err
+	}
+	if err = smtpClient.Rcpt(to); err != nil {
+		return err
+	}
+
+	// Send the email body.
+	wc, err := smtpClient.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(wc, "To: %s\r\nSubject: %s\r\n\r\n%s", to, subject, body); err != nil {
+		return err
+	}
+	if err = wc.Close(); err != nil {
+		return err
+	}
+
+	// Send the QUIT command and close the connection.
+	return smtpClient.Quit()
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestBlurHash(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{R: 30, G: 144, B: 255, A: 255}), image.Point{}, draw.Src)
+
+	hash := BlurHash(img, 4, 3)
+	if len(hash) != 28 {
+		t.Fatalf("BlurHash = %q, want 28 characters", hash)
+	}
+	// The size flag, then after the AC maximum the average color, which for
+	// a solid image is that color.
+	if hash[:1] != encode83(3+2*9, 1) || hash[2:6] != encode83(0x1E90FF, 4) {
+		t.Errorf("BlurHash = %q, want size flag %q and DC %q", hash, encode83(3+2*9, 1), encode83(0x1E90FF, 4))
+	}
+}
@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+)
+
+// RefreshTokenTTL is how long a refresh token is valid, REFRESH_TOKEN_DAYS
+// (30 by default).
+func RefreshTokenTTL() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("REFRESH_TOKEN_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return 30 * 24 * time.Hour
+}
+
+// NewRefreshToken returns a random refresh token for the client and the hash
+// stored in its place, so a database leak doesn't leak usable tokens.
+func NewRefreshToken() (token, hash string, err error) {
+	tokenByte := make([]byte, 32)
+	if _, err = rand.Read(tokenByte); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(tokenByte)
+	return token, HashRefreshToken(token), nil
+}
+
+func HashRefreshToken(token string) string {
+	hashed := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hashed[:])
+}
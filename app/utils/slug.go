@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Slugify turns a display name into a URL safe slug: "Elden Ring / DLC" ->
+// "elden-ring-dlc". Letters and digits are kept, everything else becomes a
+// single hyphen.
+func Slugify(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "-")
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMetadataUnsupported is returned by StripMetadata for file formats it
+// can't remove metadata from.
+var ErrMetadataUnsupported = errors.New("can't remove metadata from this file format")
+
+// StripMetadata returns data without the EXIF and XMP metadata of JPEG, PNG
+// and WebP images, which is where cameras and phones put GPS coordinates.
+// GIFs carry none and are returned unchanged. Other formats, HEIC among
+// them, and malformed files give ErrMetadataUnsupported.
+func StripMetadata(data []byte) ([]byte, error) {
+	var out []byte
+	ok := false
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		out, ok = stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		out, ok = stripPNG(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		out, ok = stripWebP(data)
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		out, ok = data, true
+	}
+	if !ok {
+		return nil, ErrMetadataUnsupported
+	}
+	return out, nil
+}
+
+// stripJPEG returns data without its EXIF and XMP (APP1) segments, or false
+// when it is not a well formed JPEG.
+func stripJPEG(data []byte) ([]byte, bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return nil, false
+		}
+		marker := data[i+1]
+		// Start of scan: the rest is compressed image data.
+		if marker == 0xDA {
+			break
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, false
+		}
+		if marker == 0xE1 {
+			i = end
+			continue
+		}
+		out = append(out, data[i:end]...)
+		i = end
+	}
+	return append(out, data[i:]...), true
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the PNG chunks holding EXIF (eXIf) and text,
+// including XMP (iTXt). None of them is needed to draw the image.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+
+// stripPNG returns data without its eXIf and text chunks, or false when it
+// is not a well formed PNG.
+func stripPNG(data []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, false
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	i := len(pngSignature)
+	for i < len(data) {
+		// Length, type, data and CRC.
+		if i+12 > len(data) {
+			return nil, false
+		}
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:i+4]))
+		if end > len(data) || end < i {
+			return nil, false
+		}
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	return out, true
+}
+
+// stripWebP returns data without its EXIF and XMP chunks, with the RIFF
+// size and the VP8X flags updated to match, or false when it is not a well
+// formed WebP.
+func stripWebP(data []byte) ([]byte, bool) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false
+	}
+	riffEnd := 8 + int(binary.LittleEndian.Uint32(data[4:8]))
+	if riffEnd > len(data) || riffEnd < 12 {
+		return nil, false
+	}
+	data = data[:riffEnd]
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	i := 12
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, false
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		// Chunks are padded to an even size.
+		end := i + 8 + size + size%2
+		if end > len(data) || end < i {
+			return nil, false
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				// Clear the EXIF and XMP flags.
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, true
+}
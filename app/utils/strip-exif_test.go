@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// pngChunk builds a PNG chunk with its CRC.
+func pngChunk(kind, payload string) string {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	return string(binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:])))
+}
+
+func TestStripMetadata(t *testing.T) {
+	// Segments: SOI, APP0 (JFIF), APP1 (EXIF), SOS and scan data.
+	jfif := "\xFF\xE0\x00\x07JFIF\x00"
+	exif := "\xFF\xE1\x00\x0AExif\x00\x00GP"
+	scan := "\xFF\xDA\x00\x02pixels\xFF\xD9"
+	ihdr := pngChunk("IHDR", "\x00\x00\x00\x01\x00\x00\x00\x01\x08\x00\x00\x00\x00")
+	idat := pngChunk("IDAT", "pixels") + pngChunk("IEND", "")
+	// RIFF size, VP8X with the alpha (0x10), EXIF (0x08) and XMP (0x04) flags.
+	webp := func(flags byte, chunks string) string {
+		body := "WEBP" + "VP8X\x0A\x00\x00\x00" + string(flags) + "\x00\x00\x00\x07\x00\x00\x07\x00\x00" + chunks
+		return "RIFF" + string(binary.LittleEndian.AppendUint32(nil, uint32(len(body)))) + body
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "JPEG", data: "\xFF\xD8" + exif + jfif + scan, want: "\xFF\xD8" + jfif + scan},
+		{name: "PNG", data: string(pngSignature) + ihdr + pngChunk("eXIf", "MM\x00*") + pngChunk("iTXt", "XML:com.adobe.xmp") + idat, want: string(pngSignature) + ihdr + idat},
+		{name: "WebP", data: webp(0x1C, "VP8L\x02\x00\x00\x00px"+"EXIF\x03\x00\x00\x00GPS\x00"), want: webp(0x10, "VP8L\x02\x00\x00\x00px")},
+		{name: "GIF", data: "GIF89a\x01\x00\x01\x00", want: "GIF89a\x01\x00\x01\x00"},
+		{name: "HEIC", data: "\x00\x00\x00\x18ftypheic", wantErr: true},
+		{name: "truncated JPEG", data: "\xFF\xD8\xFF\xE1\x10\x00Exif", wantErr: true},
+		{name: "truncated PNG", data: string(pngSignature) + ihdr[:10], wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := StripMetadata([]byte(tt.data))
+		if tt.wantErr {
+			if !errors.Is(err, ErrMetadataUnsupported) {
+				t.Errorf("%s: StripMetadata error = %v, want ErrMetadataUnsupported", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, []byte(tt.want)) {
+			t.Errorf("%s: StripMetadata = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
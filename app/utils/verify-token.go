@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// verifyEmailAudience marks email verification tokens, so they can't be used
+// as access tokens and access tokens can't verify an email.
+const verifyEmailAudience = "verify-email"
+
+// VerificationClaims are the claims of an email verification token. Email is
+// the address being verified; the token stops working once the user's email
+// is a different one.
+type VerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// EmailVerificationTTL is how long verification links work,
+// EMAIL_VERIFY_HOURS (24 by default).
+func EmailVerificationTTL() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("EMAIL_VERIFY_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// SignedVerificationToken signs a token verifying email for userID.
+func SignedVerificationToken(userID, email string) (string, error) {
+	now := time.Now()
+	return signToken(&VerificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{verifyEmailAudience},
+			Issuer:    "imagesearch",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(EmailVerificationTTL())),
+		},
+	})
+}
+
+// ParseVerificationToken verifies an email verification token and returns
+// its claims.
+func ParseVerificationToken(tokenString string) (*VerificationClaims, error) {
+	claims := &VerificationClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}),
+		jwt.WithAudience(verifyEmailAudience),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Subject == "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}